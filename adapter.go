@@ -0,0 +1,76 @@
+package kvolt
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// WrapH adapts a standard http.Handler into a KVolt handler.
+func WrapH(h http.Handler) context.HandlerFunc {
+	return func(c *context.Context) error {
+		h.ServeHTTP(c.Writer, c.Request)
+		return nil
+	}
+}
+
+// WrapF adapts a standard http.HandlerFunc into a KVolt handler.
+func WrapF(f http.HandlerFunc) context.HandlerFunc {
+	return WrapH(f)
+}
+
+// mountMethods is the method set Mount registers. CONNECT and TRACE are left
+// out; register them explicitly if the mounted handler needs them.
+var mountMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete,
+}
+
+// Mount serves h for the common methods (see mountMethods) under prefix, with
+// the prefix stripped from the request path (e.g. "/admin/users" reaches h as
+// "/users"). It registers prefix, prefix+"/" and a prefix+"/*path" catch-all,
+// so paths that merely start with the prefix ("/administrator") are routed
+// as usual. h can be another *kvolt.Engine, an http.ServeMux or any
+// http.Handler.
+func (group *RouterGroup) Mount(prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	handler := WrapH(stripPrefix(group.prefix+prefix, h))
+
+	if prefix != "" {
+		group.Match(mountMethods, prefix, handler)
+	}
+	group.Match(mountMethods, prefix+"/", handler)
+	group.Match(mountMethods, prefix+"/*path", handler)
+}
+
+// stripPrefix is like http.StripPrefix, but keeps the remaining path rooted at "/"
+// so mounted routers always see an absolute path.
+func stripPrefix(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		if len(p) == len(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		if p == "" {
+			p = "/"
+		}
+		rp := strings.TrimPrefix(r.URL.RawPath, prefix)
+		if r.URL.RawPath != "" && rp == "" {
+			rp = "/"
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = rp
+		h.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,497 @@
+package context
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Binder decodes part of a request into obj, a pointer (usually to a
+// struct). Binders only decode; the Context methods validate afterwards.
+type Binder interface {
+	Bind(c *Context, obj interface{}) error
+}
+
+// BodyBinder is a Binder that can also decode a body that was already
+// read, which ShouldBindBodyWith needs.
+type BodyBinder interface {
+	Binder
+	BindBody(body []byte, obj interface{}) error
+}
+
+// Built-in binders. The form, query, uri and header binders fill the
+// struct fields carrying the tag of the same name:
+//
+//	type Search struct {
+//		Org   string                `uri:"org"`
+//		Q     string                `query:"q"`
+//		Token string                `header:"X-Token"`
+//		Name  string                `form:"name"`
+//		File  *multipart.FileHeader `form:"file"`
+//	}
+//
+// BindingQuery falls back to the form tag, so `form:"page"` also works for
+// query parameters. BindingQueryTag reads only the query tag, so it cannot
+// overwrite form fields already decoded from the body.
+var (
+	BindingJSON     BodyBinder = jsonBinding{}
+	BindingXML      BodyBinder = xmlBinding{}
+	BindingForm     BodyBinder = formBinding{} // urlencoded and multipart bodies, plus the query
+	BindingQuery    Binder     = queryBinding{tags: []string{"query", "form"}}
+	BindingQueryTag Binder     = queryBinding{tags: []string{"query"}}
+	BindingURI      Binder     = uriBinding{}
+	BindingHeader   Binder     = headerBinding{}
+)
+
+// BindError reports a request that could not be decoded. Status is 400,
+// or 415 for a Content-Type without a binder. The engine's error handlers
+// render it with that status.
+type BindError struct {
+	Status int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *BindError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the decoding error.
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns Status.
+func (e *BindError) StatusCode() int {
+	return e.Status
+}
+
+var (
+	bindersMu sync.RWMutex
+	binders   = map[string]Binder{
+		"application/json":                  BindingJSON,
+		"application/xml":                   BindingXML,
+		"text/xml":                          BindingXML,
+		"application/x-www-form-urlencoded": BindingForm,
+		"multipart/form-data":               BindingForm,
+	}
+)
+
+// RegisterBinder makes Bind use b for requests whose Content-Type has the
+// given media type (e.g. "application/msgpack"). It replaces any binder
+// registered for it, including the built-in ones.
+func RegisterBinder(mediaType string, b Binder) {
+	bindersMu.Lock()
+	binders[mediaType] = b
+	bindersMu.Unlock()
+}
+
+// LookupBinder returns the binder registered for a media type, or nil.
+func LookupBinder(mediaType string) Binder {
+	bindersMu.RLock()
+	defer bindersMu.RUnlock()
+	return binders[mediaType]
+}
+
+// Bind decodes the request into obj according to its Content-Type and
+// validates it. A request without a body is bound from the query string.
+// An unknown Content-Type is a 415 and a malformed body a 400 (*BindError).
+func (c *Context) Bind(obj interface{}) error {
+	if !hasBody(c.Request) {
+		return c.BindWith(obj, BindingQuery)
+	}
+	if err := c.DecodeBody(obj); err != nil {
+		return err
+	}
+	return c.validateStruct(obj)
+}
+
+// DecodeBody decodes the request body into obj according to its
+// Content-Type (JSON when unset), like Bind, but does not validate. It does
+// nothing for a request without a body. Errors are *BindError.
+func (c *Context) DecodeBody(obj interface{}) error {
+	if !hasBody(c.Request) {
+		return nil
+	}
+	mediaType := mediaType(c.Request)
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	b := LookupBinder(mediaType)
+	if b == nil {
+		return &BindError{
+			Status: http.StatusUnsupportedMediaType,
+			Err:    errors.New("unsupported content type " + strconv.Quote(mediaType)),
+		}
+	}
+	if err := b.Bind(c, obj); err != nil {
+		return bindError(err)
+	}
+	return nil
+}
+
+// BindWith decodes the request into obj with b and validates it.
+func (c *Context) BindWith(obj interface{}, b Binder) error {
+	if err := b.Bind(c, obj); err != nil {
+		return bindError(err)
+	}
+	return c.validateStruct(obj)
+}
+
+// BindQuery binds the query string ("query" or "form" tags) and validates.
+func (c *Context) BindQuery(obj interface{}) error {
+	return c.BindWith(obj, BindingQuery)
+}
+
+// BindURI binds the path params ("uri" tags) and validates.
+func (c *Context) BindURI(obj interface{}) error {
+	return c.BindWith(obj, BindingURI)
+}
+
+// BindHeader binds request headers ("header" tags) and validates.
+func (c *Context) BindHeader(obj interface{}) error {
+	return c.BindWith(obj, BindingHeader)
+}
+
+// ShouldBindBodyWith binds the body with b and validates, like BindWith,
+// but reads the body only once and keeps it for the rest of the request,
+// so it can be bound again, e.g. into another struct or with another
+// binder.
+func (c *Context) ShouldBindBodyWith(obj interface{}, b BodyBinder) error {
+	if c.body == nil {
+		body := []byte{}
+		if c.Request.Body != nil {
+			var err error
+			if body, err = io.ReadAll(c.Request.Body); err != nil {
+				return err
+			}
+		}
+		c.body = body
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err := b.BindBody(c.body, obj); err != nil {
+		return bindError(err)
+	}
+	return c.validateStruct(obj)
+}
+
+// validateStruct validates obj if it points to a struct.
+func (c *Context) validateStruct(obj interface{}) error {
+	if indirectType(reflect.TypeOf(obj)).Kind() != reflect.Struct {
+		return nil
+	}
+	return c.Validate(obj)
+}
+
+func bindError(err error) error {
+	var be *BindError
+	if errors.As(err, &be) {
+		return err
+	}
+	return &BindError{Status: http.StatusBadRequest, Err: err}
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+func mediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	return mt
+}
+
+// ErrEmptyBody is returned by the JSON and XML binders for an empty body.
+var ErrEmptyBody = errors.New("request body is empty")
+
+type jsonBinding struct{}
+
+func (jsonBinding) Bind(c *Context, obj interface{}) error {
+	if c.Request.Body == nil {
+		return ErrEmptyBody
+	}
+	if err := sonic.ConfigDefault.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrEmptyBody
+		}
+		return err
+	}
+	return nil
+}
+
+func (jsonBinding) BindBody(body []byte, obj interface{}) error {
+	if len(body) == 0 {
+		return ErrEmptyBody
+	}
+	return sonic.ConfigDefault.Unmarshal(body, obj)
+}
+
+type xmlBinding struct{}
+
+func (xmlBinding) Bind(c *Context, obj interface{}) error {
+	if c.Request.Body == nil {
+		return ErrEmptyBody
+	}
+	if err := xml.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrEmptyBody
+		}
+		return err
+	}
+	return nil
+}
+
+func (xmlBinding) BindBody(body []byte, obj interface{}) error {
+	if len(body) == 0 {
+		return ErrEmptyBody
+	}
+	return xml.Unmarshal(body, obj)
+}
+
+type formBinding struct{}
+
+func (formBinding) Bind(c *Context, obj interface{}) error {
+	r := c.Request
+	if err := r.ParseMultipartForm(defaultMultipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	var files map[string][]*multipart.FileHeader
+	if r.MultipartForm != nil {
+		files = r.MultipartForm.File
+	}
+	return bindFields(obj, tagSource{
+		tags:   []string{"form"},
+		values: valuesGetter(r.Form),
+		files:  files,
+	})
+}
+
+func (formBinding) BindBody(body []byte, obj interface{}) error {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	return bindFields(obj, tagSource{tags: []string{"form"}, values: valuesGetter(values)})
+}
+
+type queryBinding struct {
+	tags []string
+}
+
+func (b queryBinding) Bind(c *Context, obj interface{}) error {
+	return bindFields(obj, tagSource{tags: b.tags, values: valuesGetter(c.queryValues())})
+}
+
+type uriBinding struct{}
+
+func (uriBinding) Bind(c *Context, obj interface{}) error {
+	return bindFields(obj, tagSource{tags: []string{"uri"}, values: func(key string) ([]string, bool) {
+		if value, ok := c.getParam(key); ok {
+			return []string{value}, true
+		}
+		return nil, false
+	}})
+}
+
+type headerBinding struct{}
+
+func (headerBinding) Bind(c *Context, obj interface{}) error {
+	return bindFields(obj, tagSource{tags: []string{"header"}, values: func(key string) ([]string, bool) {
+		values := c.Request.Header.Values(key)
+		return values, len(values) > 0
+	}})
+}
+
+func valuesGetter(values url.Values) func(string) ([]string, bool) {
+	return func(key string) ([]string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+// tagSource supplies the values of struct fields by tag name.
+type tagSource struct {
+	tags   []string // tried in order; the first one present names the field
+	values func(key string) ([]string, bool)
+	files  map[string][]*multipart.FileHeader // multipart uploads, may be nil
+}
+
+func (s tagSource) name(field reflect.StructField) string {
+	for _, tag := range s.tags {
+		if name := field.Tag.Get(tag); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// bindFields sets the tagged fields of the struct pointed to by ptr from
+// src. Missing keys leave a field untouched. Embedded structs are walked;
+// "-" skips a field.
+func bindFields(ptr interface{}, src tagSource) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("bind target must be a non-nil pointer, got %T", ptr)
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return bindStruct(v, src)
+}
+
+var (
+	durationType   = reflect.TypeOf(time.Duration(0))
+	timeType       = reflect.TypeOf(time.Time{})
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+func bindStruct(v reflect.Value, src tagSource) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		name := src.name(field)
+		if name == "" {
+			if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						fv.Set(reflect.New(field.Type.Elem()))
+					}
+					fv = fv.Elem()
+				}
+				if err := bindStruct(fv, src); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+
+		switch field.Type {
+		case fileHeaderType:
+			if files := src.files[name]; len(files) > 0 {
+				fv.Set(reflect.ValueOf(files[0]))
+			}
+			continue
+		case reflect.SliceOf(fileHeaderType):
+			if files := src.files[name]; len(files) > 0 {
+				fv.Set(reflect.ValueOf(files))
+			}
+			continue
+		}
+
+		values, ok := src.values(name)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, values); err != nil {
+			return fmt.Errorf("%s %q: %w", src.tags[0], name, err)
+		}
+	}
+	return nil
+}
+
+// setField converts values into the field: slices take every value,
+// other kinds the first one.
+func setField(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setField(fv.Elem(), values)
+	}
+	if fv.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, values[0])
+}
+
+func setValue(fv reflect.Value, s string) error {
+	switch fv.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case timeType:
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
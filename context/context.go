@@ -1,76 +1,120 @@
 package context
 
 import (
+	"errors"
 	"html/template"
 	"io"
 	"log"
+	"math"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 
 	"github.com/bytedance/sonic"
 	"github.com/go-kvolt/kvolt/router"
-	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/websocket"
 )
 
-// validate holds the global validator instance.
-var validate = validator.New()
+// validate holds the global validator instance, configured by newValidator
+// before anything can use it.
+var validate = newValidator()
 
 // HandlerFunc matches the KVolt handler signature.
 type HandlerFunc func(*Context) error
 
 // Context is the context for the current request.
 // It wraps http.ResponseWriter and *http.Request and adds helper methods.
+// It is also a standard context.Context (see Deadline, Done, Err and Value).
 type Context struct {
-	Writer  http.ResponseWriter
+	// Writer tracks the status and size of the response. Middleware may
+	// replace it with a ResponseWriter that wraps it.
+	Writer  ResponseWriter
 	Request *http.Request
 
 	// Handlers is the middleware chain for this request
 	Handlers []HandlerFunc
 
-	// Params are the route parameters
+	// Params are the route parameters. The slice is reused by the next
+	// request; copy it to keep values beyond the handler.
 	Params router.Params
 
 	// index is the current middleware index
 	index int
 
-	// headerWritten ensures we don't write headers twice
-	headerWritten bool
+	// writer is the ResponseWriter of the request, reused with the context
+	writer responseWriter
+
+	// queryCache and formCache hold the parsed query and form body
+	queryCache url.Values
+	formCache  url.Values
+	// body is the request body kept by ShouldBindBodyWith
+	body []byte
+
+	// Errors lists the errors of the request in order: those returned by
+	// handlers, passed to HandleError or recorded with Error. Like Params,
+	// the slice is reused by the next request.
+	Errors []error
 
 	// Keys is a key/value pair exclusively for the context of each request.
 	Keys map[string]interface{}
 
 	// Templates holds the parsed templates (injected by Engine)
 	Templates *template.Template
+
+	// URLBuilder builds named route URLs (injected by Engine).
+	URLBuilder func(name string, params ...interface{}) (string, error)
+
+	// Renderers are the renderers Negotiate picks from (injected by Engine).
+	// When nil, JSON, XML and YAML are offered.
+	Renderers *Renderers
+
+	// Closing is closed when the engine starts shutting down (injected by
+	// Engine), which ends Stream and StreamEvents.
+	Closing <-chan struct{}
+
+	// ErrorHandler renders errors returned by handlers (injected by Engine).
+	// When nil, a generic 500 JSON response is written.
+	ErrorHandler func(c *Context, err error)
 }
 
 // New creates a new Context.
 func New(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
-		Writer:  w,
+	c := &Context{
 		Request: r,
 		index:   -1,
 	}
+	c.writer.reset(w)
+	c.Writer = &c.writer
+	return c
 }
 
 // HeaderWritten reports whether the response headers have been sent.
 // Used by middleware (e.g. Recovery) to avoid writing after response started.
 func (c *Context) HeaderWritten() bool {
-	return c.headerWritten
+	return c.Writer.Written()
 }
 
 // Reset re-initializes the context for a new request.
 // Crucial for sync.Pool reuse.
 func (c *Context) Reset(w http.ResponseWriter, r *http.Request) {
-	c.Writer = w
+	c.writer.reset(w)
+	c.Writer = &c.writer
 	c.Request = r
 	c.Handlers = nil
-	c.Params = nil
+	c.Params = c.Params[:0] // keep the capacity sized by the Engine
+	c.queryCache = nil
+	c.formCache = nil
+	c.body = nil
+	clear(c.Errors)
+	c.Errors = c.Errors[:0]
 	c.Keys = nil
 	c.Templates = nil // Reset templates
+	c.ErrorHandler = nil
+	c.Renderers = nil
+	c.Closing = nil
+	c.URLBuilder = nil
 	c.index = -1
-	c.headerWritten = false
 }
 
 // Set is used to store a new key/value pair exclusively for this context.
@@ -99,93 +143,193 @@ func (c *Context) MustGet(key string) interface{} {
 	panic("Key \"" + key + "\" does not exist")
 }
 
+// Copy returns a copy of c that stays valid after the request ends, for
+// goroutines that outlive the handler. Params, Keys and Errors are copied;
+// the Request and Writer are shared, so the copy must not write the
+// response once the handler has returned. Calling Next on the copy runs
+// the rest of the chain with it.
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Writer:       c.Writer,
+		Request:      c.Request,
+		Handlers:     c.Handlers,
+		Params:       append(router.Params(nil), c.Params...),
+		index:        c.index,
+		queryCache:   c.queryCache,
+		formCache:    c.formCache,
+		body:         c.body,
+		Errors:       append([]error(nil), c.Errors...),
+		Templates:    c.Templates,
+		URLBuilder:   c.URLBuilder,
+		Renderers:    c.Renderers,
+		Closing:      c.Closing,
+		ErrorHandler: c.ErrorHandler,
+	}
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	return cp
+}
+
 // Param returns the value of the URL param.
 func (c *Context) Param(key string) string {
 	return c.Params.Get(key)
 }
 
-// Bind decodes the request body into obj and validates it.
-// Currently supports JSON.
-func (c *Context) Bind(obj interface{}) error {
-	// 1. Decode JSON
-	// We assume JSON by default or if Content-Type is application/json
-	if err := sonic.ConfigDefault.NewDecoder(c.Request.Body).Decode(obj); err != nil {
-		return err
+// URLFor builds the path of a named route, e.g. c.URLFor("user.show", 42).
+func (c *Context) URLFor(name string, params ...interface{}) (string, error) {
+	if c.URLBuilder == nil {
+		return "", errors.New("kvolt: no URL builder (context not served by an Engine)")
 	}
-
-	// 2. Validate
-	return validate.Struct(obj)
+	return c.URLBuilder(name, params...)
 }
 
+// abortIndex is past any chain; Next does nothing once index reaches it.
+const abortIndex = math.MaxInt / 2
+
 // Next executes the next middleware in the chain.
-// If a handler returns an error and no response has been written yet,
-// a 500 Internal Server Error is sent and the chain is stopped.
+// If a handler returns an error, it is passed to HandleError and the chain is aborted.
 func (c *Context) Next() {
 	c.index++
 	if c.index < len(c.Handlers) {
 		handler := c.Handlers[c.index]
 		if err := handler(c); err != nil {
-			log.Printf("[KVolt] handler error: %v", err)
-			if !c.headerWritten {
-				c.Writer.Header().Set("Content-Type", "application/json")
-				c.Writer.WriteHeader(http.StatusInternalServerError)
-				c.headerWritten = true
-				// Safe JSON error message; do not expose internal details
-				body := map[string]string{"error": "Internal Server Error"}
-				_ = sonic.ConfigDefault.NewEncoder(c.Writer).Encode(body)
-			}
+			c.Abort()
+			c.HandleError(err)
 			return
 		}
 	}
 }
 
-// Status sets the HTTP status code.
-func (c *Context) Status(code int) *Context {
-	if !c.headerWritten {
+// Abort stops the chain: the handlers after the current one do not run,
+// even if it calls Next. Middleware that already ran still finishes.
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted reports whether the chain was aborted, by Abort or because a
+// handler returned an error.
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus aborts the chain and sends the status code without a body.
+func (c *Context) AbortWithStatus(code int) {
+	c.Abort()
+	c.Status(code)
+}
+
+// AbortWithStatusJSON aborts the chain and sends obj as JSON.
+//
+//	return c.AbortWithStatusJSON(403, map[string]string{"error": "read only"})
+func (c *Context) AbortWithStatusJSON(code int, obj interface{}) error {
+	c.Abort()
+	return c.JSON(code, obj)
+}
+
+// AbortWithError aborts the chain and renders err through HandleError as
+// a *StatusError with the given status; the engine's error handlers send
+// the status text and keep err internal. It returns nil, so a handler can
+// end with it:
+//
+//	return c.AbortWithError(http.StatusForbidden, err)
+func (c *Context) AbortWithError(code int, err error) error {
+	c.Abort()
+	c.HandleError(&StatusError{Status: code, Err: err})
+	return nil
+}
+
+// Error records err in c.Errors without stopping the chain or writing a
+// response, e.g. for a failure the handler can recover from. It returns err.
+func (c *Context) Error(err error) error {
+	c.Errors = append(c.Errors, err)
+	return err
+}
+
+// StatusError is an error with the HTTP status it should be answered with,
+// created by AbortWithError. Err is not shown to the client.
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns Err.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns Status.
+func (e *StatusError) StatusCode() int {
+	return e.Status
+}
+
+// HandleError records err in c.Errors and renders it through the engine's
+// error handler. Without one, the error is logged and its status (500 unless
+// it has a StatusCode method) is sent if no response has been written yet.
+func (c *Context) HandleError(err error) {
+	c.Errors = append(c.Errors, err)
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(c, err)
+		return
+	}
+	log.Printf("[KVolt] handler error: %v", err)
+	if !c.Writer.Written() {
+		code := http.StatusInternalServerError
+		var sc interface{ StatusCode() int }
+		if errors.As(err, &sc) {
+			code = sc.StatusCode()
+		}
+		c.Writer.Header().Set("Content-Type", "application/json")
 		c.Writer.WriteHeader(code)
-		c.headerWritten = true
+		// Safe JSON error message; do not expose internal details
+		body := map[string]string{"error": http.StatusText(code)}
+		_ = sonic.ConfigDefault.NewEncoder(c.Writer).Encode(body)
 	}
+}
+
+// Status sends the headers with the HTTP status code, unless they were
+// already sent.
+func (c *Context) Status(code int) *Context {
+	c.Writer.WriteHeader(code)
 	return c
 }
 
-// JSON sends a JSON response.
+// JSON sends a JSON response. Like encoding/json, it escapes <, > and &
+// so the output is safe to embed in HTML; see PureJSON.
 func (c *Context) JSON(code int, obj interface{}) error {
-	c.Writer.Header().Set("Content-Type", "application/json")
-	if !c.headerWritten {
-		c.Writer.WriteHeader(code)
-		c.headerWritten = true
-	}
-	return sonic.ConfigDefault.NewEncoder(c.Writer).Encode(obj)
+	return c.Render(code, RenderJSON, obj)
 }
 
 // String sends a plain text response.
 func (c *Context) String(code int, format string, values ...interface{}) error {
 	c.Writer.Header().Set("Content-Type", "text/plain")
-	if !c.headerWritten {
-		c.Writer.WriteHeader(code)
-		c.headerWritten = true
-	}
+	c.Writer.WriteHeader(code)
 	_, err := c.Writer.Write([]byte(format))
 	return err
 }
 
 // RenderHTML renders the template with data and sets values content-type to "text/html".
 func (c *Context) RenderHTML(code int, name string, data interface{}) error {
-	c.Status(code)
-	c.Writer.Header().Set("Content-Type", "text/html")
 	if c.Templates == nil {
 		return c.String(500, "Templates not loaded")
 	}
+	c.Writer.Header().Set("Content-Type", "text/html")
+	c.Status(code)
 	return c.Templates.ExecuteTemplate(c.Writer, name, data)
 }
 
 // HTML sends an HTML response (Raw String).
 func (c *Context) HTML(code int, html string) error {
 	c.Writer.Header().Set("Content-Type", "text/html")
-	if !c.headerWritten {
-		c.Writer.WriteHeader(code)
-		c.headerWritten = true
-	}
+	c.Writer.WriteHeader(code)
 	_, err := c.Writer.Write([]byte(html))
 	return err
 }
@@ -193,7 +337,7 @@ func (c *Context) HTML(code int, html string) error {
 // FormFile returns the first file for the provided form key.
 func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
 	if c.Request.MultipartForm == nil {
-		if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB default
+		if err := c.Request.ParseMultipartForm(defaultMultipartMemory); err != nil {
 			return nil, err
 		}
 	}
@@ -223,6 +367,12 @@ func (c *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error
 	return err
 }
 
+// Redirect sends a redirect to location with the given 3xx status code.
+func (c *Context) Redirect(code int, location string) error {
+	http.Redirect(c.Writer, c.Request, location, code)
+	return nil
+}
+
 // File writes the specified file into the body stream in an efficient way.
 func (c *Context) File(filepath string) {
 	http.ServeFile(c.Writer, c.Request, filepath)
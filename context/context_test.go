@@ -1,10 +1,17 @@
 package context
 
 import (
+	"bytes"
+	stdContext "context"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kvolt/kvolt/router"
 )
@@ -13,7 +20,7 @@ func TestContext_New(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/", nil)
 	c := New(w, r)
-	if c.Writer != w || c.Request != r {
+	if c.Writer.Unwrap() != w || c.Request != r {
 		t.Error("New: Writer or Request not set")
 	}
 	if c.index != -1 {
@@ -66,10 +73,13 @@ func TestContext_Reset(t *testing.T) {
 	r2 := httptest.NewRequest("POST", "/other", nil)
 	c.Reset(w2, r2)
 
-	if c.Keys != nil || c.Handlers != nil || c.Params != nil {
-		t.Error("Reset: Keys, Handlers, Params should be nil")
+	if c.Keys != nil || c.Handlers != nil {
+		t.Error("Reset: Keys, Handlers should be nil")
 	}
-	if c.index != -1 || c.Writer != w2 || c.Request != r2 {
+	if len(c.Params) != 0 || cap(c.Params) != 1 {
+		t.Error("Reset: Params should be empty with its capacity kept")
+	}
+	if c.index != -1 || c.Writer.Unwrap() != w2 || c.Request != r2 {
 		t.Error("Reset: index or Writer/Request not reset")
 	}
 }
@@ -104,3 +114,698 @@ func TestContext_Next_HandlerError(t *testing.T) {
 		t.Errorf("Next handler error: want application/json, got %s", w.Header().Get("Content-Type"))
 	}
 }
+
+func TestContext_NegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"application/xml", "application/xml"},
+		{"application/*;q=0.5, application/xml", "application/xml"},
+		{"text/html, */*;q=0.1", "application/json"},
+		{"application/json;q=0, */*", "application/xml"},
+		{"text/csv", ""},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		c := New(httptest.NewRecorder(), r)
+		if got := c.NegotiateFormat("application/json", "application/xml"); got != tc.want {
+			t.Errorf("Accept %q: want %q, got %q", tc.accept, tc.want, got)
+		}
+	}
+}
+
+type renderRow struct {
+	Name  string    `json:"name"`
+	Score int       `csv:"points"`
+	When  time.Time `json:"-" csv:"when"`
+	Note  string    `csv:"-"`
+}
+
+func TestContext_Render(t *testing.T) {
+	render := func(target string, fn func(c *Context) error) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		if err := fn(New(w, httptest.NewRequest("GET", target, nil))); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		return w
+	}
+	row := renderRow{Name: "<b>", Score: 3, When: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)}
+
+	cases := []struct {
+		name, ct, body string
+		fn             func(c *Context) error
+	}{
+		{"XML", "application/xml", "<renderRow><Name>&lt;b&gt;</Name>", func(c *Context) error { return c.XML(200, row) }},
+		{"YAML", "application/yaml", "name: <b>\nscore: 3\n", func(c *Context) error { return c.YAML(200, map[string]interface{}{"name": "<b>", "score": 3}) }},
+		{"JSON", "application/json", `{"a":"\u003cb\u003e\u0026"}`, func(c *Context) error { return c.JSON(200, map[string]string{"a": "<b>&"}) }},
+		{"PureJSON", "application/json", `{"a":"<b>&"}`, func(c *Context) error { return c.PureJSON(200, map[string]string{"a": "<b>&"}) }},
+		{"AsciiJSON", "application/json", `{"a":"caf\u00e9 \ud83d\ude00"}`, func(c *Context) error { return c.AsciiJSON(200, map[string]string{"a": "café 😀"}) }},
+		{"CSV", "text/csv", "name,points,when\n<b>,3,2026-01-02T00:00:00Z\n", func(c *Context) error { return c.CSV(200, []renderRow{row}) }},
+		{"CSV rows", "text/csv", "a,b\n1,2\n", func(c *Context) error { return c.CSV(200, [][]string{{"a", "b"}, {"1", "2"}}) }},
+	}
+	for _, tc := range cases {
+		w := render("/", tc.fn)
+		if ct := w.Header().Get("Content-Type"); ct != tc.ct || !strings.Contains(w.Body.String(), tc.body) {
+			t.Errorf("%s: want %s containing %q, got %s %q", tc.name, tc.ct, tc.body, ct, w.Body.String())
+		}
+	}
+
+	rows := make(chan renderRow)
+	go func() {
+		defer close(rows)
+		rows <- renderRow{Name: "a"}
+		rows <- renderRow{Name: "b"}
+	}()
+	w := render("/", func(c *Context) error { return c.NDJSON(200, rows) })
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 2 || !w.Flushed ||
+		!strings.HasPrefix(lines[1], `{"name":"b"`) {
+		t.Errorf("NDJSON channel: want 2 flushed lines, got %q (flushed %v)", w.Body.String(), w.Flushed)
+	}
+
+	w = render("/?callback=app.done", func(c *Context) error { return c.JSONP(200, []int{1}) })
+	if w.Header().Get("Content-Type") != "application/javascript" || w.Body.String() != "/**/app.done([1]);" {
+		t.Errorf("JSONP: got %s %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+	c := New(httptest.NewRecorder(), httptest.NewRequest("GET", "/?callback=alert(1)", nil))
+	var pe *ParamError
+	if err := c.JSONP(200, 1); !errors.As(err, &pe) {
+		t.Errorf("JSONP bad callback: want *ParamError, got %v", err)
+	}
+
+	// A failed encoding sends nothing, so the error can still be rendered
+	w = httptest.NewRecorder()
+	c = New(w, httptest.NewRequest("GET", "/", nil))
+	if err := c.XML(200, map[string]interface{}{"a": 1}); err == nil {
+		t.Error("XML of a map: want error")
+	}
+	if c.Writer.Written() || w.Header().Get("Content-Type") != "" || w.Body.Len() != 0 {
+		t.Errorf("XML of a map: want nothing written, got %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+type textRenderer struct{}
+
+func (textRenderer) ContentType() string { return "text/plain" }
+
+func (textRenderer) Render(w io.Writer, obj interface{}) error {
+	_, err := fmt.Fprint(w, obj)
+	return err
+}
+
+func TestContext_Negotiate(t *testing.T) {
+	renderers := NewRenderers()
+	renderers.Register("text/plain", textRenderer{})
+	negotiate := func(accept string, offers ...string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		c := New(w, r)
+		c.Renderers = renderers
+		return w, c.Negotiate(200, "hi", offers...)
+	}
+
+	for accept, want := range map[string]string{
+		"":                                    "application/json",
+		"application/yaml":                    "application/yaml",
+		"text/*, application/json;q=0.9":      "text/plain",
+		"application/xml;q=0.5, text/plain":   "text/plain",
+		"application/*;q=0.8, text/plain;q=0": "application/json",
+		"Application/YAML":                    "application/yaml",
+		"TEXT/*":                              "text/plain",
+	} {
+		if w, err := negotiate(accept); err != nil || w.Header().Get("Content-Type") != want {
+			t.Errorf("Accept %q: want %s, got %s (%v)", accept, want, w.Header().Get("Content-Type"), err)
+		}
+	}
+
+	if w, _ := negotiate("*/*", "text/csv", "text/plain"); w.Body.String() != "hi" {
+		t.Errorf("offers: want unregistered types skipped, got %q", w.Body.String())
+	}
+	w, err := negotiate("image/png")
+	var nae *NotAcceptableError
+	if !errors.As(err, &nae) || nae.StatusCode() != http.StatusNotAcceptable || w.Body.Len() != 0 {
+		t.Errorf("no match: want *NotAcceptableError and no body, got %v %q", err, w.Body.String())
+	}
+}
+
+func TestContext_Query(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?q=kvolt&empty=&id=1&id=2&filter[status]=open&filter[owner]=me&filter=x", nil)
+	c := New(httptest.NewRecorder(), r)
+
+	if got := c.Query("q"); got != "kvolt" {
+		t.Errorf("Query(q) = %q", got)
+	}
+	if got, ok := c.GetQuery("empty"); got != "" || !ok {
+		t.Errorf("GetQuery(empty) = %q, %v; want \"\", true", got, ok)
+	}
+	if got := c.DefaultQuery("empty", "d"); got != "" {
+		t.Errorf("DefaultQuery(empty) = %q, want present empty value", got)
+	}
+	if got := c.DefaultQuery("missing", "d"); got != "d" {
+		t.Errorf("DefaultQuery(missing) = %q", got)
+	}
+	if got := c.QueryArray("id"); fmt.Sprint(got) != "[1 2]" {
+		t.Errorf("QueryArray(id) = %v", got)
+	}
+	if got := c.QueryMap("filter"); len(got) != 2 || got["status"] != "open" || got["owner"] != "me" {
+		t.Errorf("QueryMap(filter) = %v", got)
+	}
+
+	// The parsed query is cached until Reset
+	r.URL.RawQuery = "q=changed"
+	if got := c.Query("q"); got != "kvolt" {
+		t.Errorf("Query after RawQuery change = %q, want cached value", got)
+	}
+	c.Reset(httptest.NewRecorder(), r)
+	if got := c.Query("q"); got != "changed" {
+		t.Errorf("Query after Reset = %q", got)
+	}
+}
+
+func TestContext_PostForm(t *testing.T) {
+	body := strings.NewReader("name=ann&tag=a&tag=b&meta[role]=admin")
+	r := httptest.NewRequest("POST", "/?name=query", body)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c := New(httptest.NewRecorder(), r)
+
+	if got := c.PostForm("name"); got != "ann" {
+		t.Errorf("PostForm(name) = %q, want body value", got)
+	}
+	if got := c.DefaultPostForm("age", "0"); got != "0" {
+		t.Errorf("DefaultPostForm(age) = %q", got)
+	}
+	if got := c.PostFormArray("tag"); fmt.Sprint(got) != "[a b]" {
+		t.Errorf("PostFormArray(tag) = %v", got)
+	}
+	if got := c.PostFormMap("meta"); got["role"] != "admin" {
+		t.Errorf("PostFormMap(meta) = %v", got)
+	}
+
+	// A GET without a body has no form values
+	c.Reset(httptest.NewRecorder(), httptest.NewRequest("GET", "/?name=x", nil))
+	if _, ok := c.GetPostForm("name"); ok {
+		t.Error("GetPostForm on GET: want no value")
+	}
+}
+
+func TestContext_TypedParams(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?page=3&big=9000000000&ok=true&flag&since=2024-05-01&ttl=1m30s&bad=x&ratio=0.5", nil)
+	c := New(httptest.NewRecorder(), r)
+	c.Params = router.Params{{Key: "id", Value: "42"}, {Key: "slug", Value: "hello"}}
+
+	if n, err := c.ParamInt("id"); n != 42 || err != nil {
+		t.Errorf("ParamInt(id) = %d, %v", n, err)
+	}
+	if n, err := c.QueryInt("page"); n != 3 || err != nil {
+		t.Errorf("QueryInt(page) = %d, %v", n, err)
+	}
+	if n, err := c.QueryInt64("big"); n != 9000000000 || err != nil {
+		t.Errorf("QueryInt64(big) = %d, %v", n, err)
+	}
+	if f, err := c.QueryFloat64("ratio"); f != 0.5 || err != nil {
+		t.Errorf("QueryFloat64(ratio) = %v, %v", f, err)
+	}
+	for _, key := range []string{"ok", "flag"} {
+		if b, err := c.QueryBool(key); !b || err != nil {
+			t.Errorf("QueryBool(%s) = %v, %v", key, b, err)
+		}
+	}
+	if tm, err := c.QueryTime("since", time.DateOnly); err != nil || tm.Month() != time.May {
+		t.Errorf("QueryTime(since) = %v, %v", tm, err)
+	}
+	if d, err := c.QueryDuration("ttl"); d != 90*time.Second || err != nil {
+		t.Errorf("QueryDuration(ttl) = %v, %v", d, err)
+	}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{second(c.ParamInt("slug")), `path parameter "slug": "hello" is not a valid int`},
+		{second(c.ParamInt64("nope")), `path parameter "nope" is missing`},
+		{second(c.QueryBool("bad")), `query parameter "bad": "x" is not a valid bool`},
+		{second(c.QueryDuration("bad")), `query parameter "bad": "x" is not a valid duration`},
+		{second(c.QueryTime("missing", time.RFC3339)), `query parameter "missing" is missing`},
+	}
+	for _, tt := range tests {
+		var pe *ParamError
+		if !errors.As(tt.err, &pe) || tt.err.Error() != tt.want {
+			t.Errorf("got %v, want ParamError %q", tt.err, tt.want)
+		}
+	}
+	if _, err := c.QueryInt("missing"); !errors.Is(err, ErrMissingParam) {
+		t.Errorf("QueryInt(missing) = %v, want ErrMissingParam", err)
+	}
+}
+
+func second[T any](_ T, err error) error { return err }
+
+type bindUser struct {
+	Name  string `json:"name" xml:"name" form:"name" validate:"required"`
+	Email string `json:"email" xml:"email" form:"email"`
+}
+
+func TestContext_BindContentType(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+	}{
+		{"application/json; charset=utf-8", `{"name":"ann","email":"a@x.io"}`},
+		{"", `{"name":"ann","email":"a@x.io"}`}, // JSON by default
+		{"application/xml", `<bindUser><name>ann</name><email>a@x.io</email></bindUser>`},
+		{"application/x-www-form-urlencoded", "name=ann&email=a%40x.io"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		var u bindUser
+		if err := New(httptest.NewRecorder(), r).Bind(&u); err != nil || u.Name != "ann" || u.Email != "a@x.io" {
+			t.Errorf("%q: got %+v, %v", tt.contentType, u, err)
+		}
+	}
+
+	// Unsupported type is a 415, malformed input a 400, failed validation neither
+	for _, tt := range []struct {
+		contentType, body string
+		status            int
+	}{
+		{"text/plain", "ann", http.StatusUnsupportedMediaType},
+		{"application/json", `{"name":`, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		var be *BindError
+		if err := New(httptest.NewRecorder(), r).Bind(&bindUser{}); !errors.As(err, &be) || be.StatusCode() != tt.status {
+			t.Errorf("%s: got %v, want BindError %d", tt.contentType, err, tt.status)
+		}
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"a@x.io"}`))
+	var be *BindError
+	if err := New(httptest.NewRecorder(), r).Bind(&bindUser{}); err == nil || errors.As(err, &be) {
+		t.Errorf("missing required field: got %v, want validation error", err)
+	}
+}
+
+func TestContext_BindMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("title", "report")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fw, _ := mw.CreateFormFile("attachments", name)
+		fw.Write([]byte("content of " + name))
+	}
+	fw, _ := mw.CreateFormFile("cover", "cover.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &buf)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	var form struct {
+		Title       string                  `form:"title"`
+		Cover       *multipart.FileHeader   `form:"cover"`
+		Attachments []*multipart.FileHeader `form:"attachments"`
+	}
+	if err := New(httptest.NewRecorder(), r).Bind(&form); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if form.Title != "report" || form.Cover == nil || form.Cover.Filename != "cover.png" || len(form.Attachments) != 2 {
+		t.Errorf("got %+v", form)
+	}
+}
+
+func TestContext_BindQueryURIHeader(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?q=go&page=2&tag=a&tag=b", nil)
+	r.Header.Set("X-Token", "secret")
+	c := New(httptest.NewRecorder(), r)
+	c.Params = router.Params{{Key: "org", Value: "acme"}}
+
+	var req struct {
+		Org   string        `uri:"org" validate:"required"`
+		Q     string        `query:"q"`
+		Page  int           `form:"page"` // form tags work for the query too
+		Tags  []string      `query:"tag"`
+		Token string        `header:"X-Token"`
+		Wait  time.Duration `query:"wait"`
+	}
+	if err := c.BindURI(&req); err != nil {
+		t.Fatalf("BindURI: %v", err)
+	}
+	if err := c.BindQuery(&req); err != nil {
+		t.Fatalf("BindQuery: %v", err)
+	}
+	if err := c.BindHeader(&req); err != nil {
+		t.Fatalf("BindHeader: %v", err)
+	}
+	if req.Org != "acme" || req.Q != "go" || req.Page != 2 || len(req.Tags) != 2 || req.Token != "secret" {
+		t.Errorf("got %+v", req)
+	}
+
+	// A body-less request is bound from the query
+	var q struct {
+		Page int `query:"page"`
+	}
+	if err := c.Bind(&q); err != nil || q.Page != 2 {
+		t.Errorf("Bind without body: got %+v, %v", q, err)
+	}
+
+	c.Reset(httptest.NewRecorder(), httptest.NewRequest("GET", "/?page=two", nil))
+	var be *BindError
+	if err := c.BindQuery(&q); !errors.As(err, &be) || be.Status != http.StatusBadRequest {
+		t.Errorf("bad int: got %v, want 400 BindError", err)
+	}
+}
+
+func TestContext_ShouldBindBodyWith(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"ann","kind":"admin"}`))
+	c := New(httptest.NewRecorder(), r)
+
+	var u bindUser
+	var meta struct {
+		Kind string `json:"kind"`
+	}
+	if err := c.ShouldBindBodyWith(&u, BindingJSON); err != nil || u.Name != "ann" {
+		t.Fatalf("first bind: %+v, %v", u, err)
+	}
+	if err := c.ShouldBindBodyWith(&meta, BindingJSON); err != nil || meta.Kind != "admin" {
+		t.Fatalf("second bind: %+v, %v", meta, err)
+	}
+	// The body stays readable for plain binders too
+	var again bindUser
+	if err := c.BindWith(&again, BindingJSON); err != nil || again.Name != "ann" {
+		t.Errorf("BindWith after ShouldBindBodyWith: %+v, %v", again, err)
+	}
+}
+
+type csvBinder struct{}
+
+func (csvBinder) Bind(c *Context, obj interface{}) error {
+	b, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	fields := strings.Split(strings.TrimSpace(string(b)), ",")
+	u := obj.(*bindUser)
+	u.Name, u.Email = fields[0], fields[1]
+	return nil
+}
+
+func TestRegisterBinder(t *testing.T) {
+	RegisterBinder("text/csv", csvBinder{})
+	defer func() {
+		bindersMu.Lock()
+		delete(binders, "text/csv")
+		bindersMu.Unlock()
+	}()
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("ann,a@x.io"))
+	r.Header.Set("Content-Type", "text/csv")
+	var u bindUser
+	if err := New(httptest.NewRecorder(), r).Bind(&u); err != nil || u.Email != "a@x.io" {
+		t.Errorf("custom binder: %+v, %v", u, err)
+	}
+}
+
+type order struct {
+	Customer string      `json:"customer" validate:"required"`
+	Items    []orderItem `json:"items" validate:"dive"`
+}
+
+type orderItem struct {
+	Email string `json:"email" validate:"email"`
+	Qty   int    `form:"qty" validate:"min=1"`
+}
+
+func TestContext_ValidatorConfiguredBeforeUse(t *testing.T) {
+	type signup struct {
+		Email string `json:"email_address" validate:"required"`
+	}
+	// Struct metadata cached by an earlier use must carry the tag names
+	validate.Struct(signup{})
+
+	var ve *ValidationError
+	if err := New(nil, httptest.NewRequest("POST", "/", nil)).Validate(signup{}); !errors.As(err, &ve) {
+		t.Fatalf("want *ValidationError, got %T %v", err, err)
+	}
+	if ve.Fields[0].Field != "email_address" || ve.Fields[0].Message != "email_address is a required field" {
+		t.Errorf("want the json tag name, got %+v", ve.Fields[0])
+	}
+}
+
+func TestContext_ValidationError(t *testing.T) {
+	obj := order{Items: []orderItem{{"a@b.co", 1}, {"a@b.co", 1}, {"nope", 0}}}
+	validateIn := func(lang string) *ValidationError {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/", nil)
+		if lang != "" {
+			r.Header.Set("Accept-Language", lang)
+		}
+		var ve *ValidationError
+		if err := New(nil, r).Validate(&obj); !errors.As(err, &ve) {
+			t.Fatalf("want *ValidationError, got %T %v", err, err)
+		}
+		return ve
+	}
+
+	ve := validateIn("")
+	want := []FieldError{
+		{Field: "customer", Rule: "required", Message: "customer is a required field"},
+		{Field: "items[2].email", Rule: "email", Message: "email must be a valid email address"},
+		{Field: "items[2].qty", Rule: "min", Param: "1", Message: "qty must be 1 or greater"},
+	}
+	if fmt.Sprint(ve.Fields) != fmt.Sprint(want) || ve.Locale != "en" {
+		t.Errorf("fields: want %v (en), got %v (%s)", want, ve.Fields, ve.Locale)
+	}
+	if ve.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("status: want 422, got %d", ve.StatusCode())
+	}
+
+	if ve = validateIn("fr;q=0.5, de-DE, en;q=0.8"); ve.Locale != "de" || ve.Fields[0].Message != "customer ist ein Pflichtfeld" {
+		t.Errorf("de-DE: want German messages, got %s %q", ve.Locale, ve.Fields[0].Message)
+	}
+	if ve = validateIn("pt-BR"); ve.Locale != "pt_BR" {
+		t.Errorf("pt-BR: want pt_BR, got %s", ve.Locale)
+	}
+	if ve = validateIn("xx, de;q=0"); ve.Locale != "en" {
+		t.Errorf("unsupported: want en fallback, got %s", ve.Locale)
+	}
+}
+
+func TestContext_SSE(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := New(w, httptest.NewRequest("GET", "/events", nil))
+	if err := c.SSE("price", map[string]int{"kv": 42}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendEvent(Event{ID: "7\n", Data: "a\nb", Retry: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	want := "event: price\ndata: {\"kv\":42}\n\nid: 7\nretry: 1000\ndata: a\ndata: b\n\n"
+	if w.Body.String() != want || w.Header().Get("Content-Type") != "text/event-stream" || !w.Flushed {
+		t.Errorf("SSE: want %q flushed as text/event-stream, got %q %s", want, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
+
+func TestContext_StreamEvents(t *testing.T) {
+	buffer := NewEventBuffer(2)
+	for _, id := range []string{"1", "2", "3"} {
+		buffer.Add(Event{ID: id, Data: id})
+	}
+
+	ctx, cancel := stdContext.WithCancel(stdContext.Background())
+	r := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+	r.Header.Set("Last-Event-ID", "2")
+	w := httptest.NewRecorder()
+	c := New(w, r)
+
+	events := make(chan Event)
+	done := make(chan error)
+	go func() {
+		done <- c.StreamEvents(events, StreamConfig{Heartbeat: 5 * time.Millisecond, Replay: buffer})
+	}()
+	events <- Event{ID: "4", Data: "4"}
+	time.Sleep(20 * time.Millisecond)
+	cancel() // client disconnects
+	if err := <-done; err != nil {
+		t.Fatalf("StreamEvents: %v", err)
+	}
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "id: 3\ndata: 3\n\nid: 4\ndata: 4\n\n") || !strings.Contains(body, ": ping\n\n") {
+		t.Errorf("StreamEvents: want replayed 3, then 4 and heartbeats, got %q", body)
+	}
+	if got := buffer.Since("unknown"); len(got) != 2 || got[0].ID != "2" {
+		t.Errorf("Since unknown ID: want the 2 buffered events, got %v", got)
+	}
+}
+
+func TestContext_Stream(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := New(w, httptest.NewRequest("GET", "/", nil))
+	n := 0
+	cut := c.Stream(func(w io.Writer) bool {
+		n++
+		fmt.Fprintf(w, "%d,", n)
+		return n < 3
+	})
+	if cut || w.Body.String() != "1,2,3," || !w.Flushed {
+		t.Errorf("Stream: want 1,2,3, flushed, got %q (cut %v)", w.Body.String(), cut)
+	}
+
+	closing := make(chan struct{})
+	c = New(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	c.Closing = closing
+	close(closing)
+	if !c.Stream(func(io.Writer) bool { return true }) {
+		t.Error("Stream: want true once Closing is closed")
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := New(rec, httptest.NewRequest("GET", "/", nil))
+	w := c.Writer
+	if w.Written() || w.Status() != 200 || w.Size() != 0 {
+		t.Fatalf("initial: want unwritten 200/0, got %v %d/%d", w.Written(), w.Status(), w.Size())
+	}
+
+	var order []string
+	w.Before(func() { order = append(order, "first"); w.Header().Set("X-Hook", "1") })
+	w.Before(func() { order = append(order, "second") })
+	_ = c.String(http.StatusCreated, "hello")
+	c.Status(http.StatusTeapot) // ignored
+	n, _ := w.ReadFrom(strings.NewReader(" world"))
+
+	if rec.Code != 201 || w.Status() != 201 || !w.Written() || w.Size() != 11 || n != 6 || rec.Body.String() != "hello world" {
+		t.Errorf("after write: got rec %d, status %d, written %v, size %d, body %q", rec.Code, w.Status(), w.Written(), w.Size(), rec.Body.String())
+	}
+	if fmt.Sprint(order) != "[first second]" || rec.Header().Get("X-Hook") != "1" {
+		t.Errorf("Before: want both hooks once, in order, before the headers; got %v %q", order, rec.Header().Get("X-Hook"))
+	}
+	if err := w.Push("/app.js", nil); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Push: want ErrNotSupported, got %v", err)
+	}
+
+	// Reuse by the pool starts from scratch
+	rec2 := httptest.NewRecorder()
+	c.Reset(rec2, httptest.NewRequest("GET", "/", nil))
+	c.Writer.Flush()
+	if c.Writer.Size() != 0 || !rec2.Flushed || rec2.Header().Get("X-Hook") != "" {
+		t.Errorf("Reset: want fresh writer without hooks, got size %d, hook %q", c.Writer.Size(), rec2.Header().Get("X-Hook"))
+	}
+	if NewResponseWriter(c.Writer) != c.Writer {
+		t.Error("NewResponseWriter: want a ResponseWriter returned as is")
+	}
+}
+
+func TestContext_Abort(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := New(w, httptest.NewRequest("GET", "/", nil))
+	var ran []string
+	var abortedAfterNext bool
+	errSoft := errors.New("cache miss")
+	c.Handlers = []HandlerFunc{
+		func(c *Context) error {
+			ran = append(ran, "outer")
+			c.Next()
+			abortedAfterNext = c.IsAborted()
+			return nil
+		},
+		func(c *Context) error {
+			ran = append(ran, "auth")
+			c.Error(errSoft)
+			if err := c.AbortWithStatusJSON(http.StatusForbidden, map[string]string{"error": "read only"}); err != nil {
+				return err
+			}
+			c.Next() // no-op once aborted
+			return nil
+		},
+		func(c *Context) error {
+			ran = append(ran, "handler")
+			return nil
+		},
+	}
+	c.Next()
+
+	if fmt.Sprint(ran) != "[outer auth]" || !abortedAfterNext || w.Code != 403 || !strings.Contains(w.Body.String(), "read only") {
+		t.Errorf("AbortWithStatusJSON: ran %v, aborted %v, got %d %s", ran, abortedAfterNext, w.Code, w.Body.String())
+	}
+	if len(c.Errors) != 1 || c.Errors[0] != errSoft {
+		t.Errorf("Error: want [cache miss], got %v", c.Errors)
+	}
+
+	// A returned error aborts and is recorded; AbortWithError keeps its cause internal
+	errCause := errors.New("row 7 is locked")
+	w = httptest.NewRecorder()
+	c.Reset(w, httptest.NewRequest("GET", "/", nil))
+	c.Handlers = []HandlerFunc{
+		func(c *Context) error {
+			c.Next()
+			return nil
+		},
+		func(c *Context) error { return c.AbortWithError(http.StatusConflict, errCause) },
+		func(c *Context) error { t.Error("handler after AbortWithError ran"); return nil },
+	}
+	c.Next()
+	var se *StatusError
+	if w.Code != 409 || strings.Contains(w.Body.String(), "row 7") || len(c.Errors) != 1 ||
+		!errors.As(c.Errors[0], &se) || !errors.Is(se, errCause) {
+		t.Errorf("AbortWithError: want 409 without the cause and a recorded *StatusError, got %d %s %v", w.Code, w.Body.String(), c.Errors)
+	}
+
+	c.Reset(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if c.IsAborted() || len(c.Errors) != 0 {
+		t.Error("Reset: want a fresh chain without errors")
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+	if !c.IsAborted() || c.Writer.Status() != 204 {
+		t.Errorf("AbortWithStatus: want aborted 204, got %d", c.Writer.Status())
+	}
+}
+
+type ctxKey struct{}
+
+func TestContext_StdContext(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	reqCtx, cancel := stdContext.WithDeadline(stdContext.WithValue(stdContext.Background(), ctxKey{}, "trace-1"), deadline)
+	c := New(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(reqCtx))
+	c.Set("user", "ada")
+
+	var ctx stdContext.Context = c
+	if ctx.Value("user") != "ada" || ctx.Value(ctxKey{}) != "trace-1" || ctx.Value("missing") != nil {
+		t.Errorf("Value: want Keys then request values, got %v %v", ctx.Value("user"), ctx.Value(ctxKey{}))
+	}
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(deadline) {
+		t.Errorf("Deadline: want %v, got %v %v", deadline, d, ok)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Err: want nil before cancel, got %v", ctx.Err())
+	}
+	cancel()
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("Done: want closed after cancel")
+	}
+	if !errors.Is(ctx.Err(), stdContext.Canceled) {
+		t.Errorf("Err: want context.Canceled, got %v", ctx.Err())
+	}
+
+	// Copy keeps its own Keys
+	cp := c.Copy()
+	cp.Set("user", "grace")
+	if c.Value("user") != "ada" || cp.Value("user") != "grace" || cp.Request != c.Request {
+		t.Error("Copy: want a separate Keys map and the same request")
+	}
+
+	var empty Context
+	if empty.Done() != nil || empty.Err() != nil || empty.Value("user") != nil {
+		t.Error("zero Context: want no Done channel, error or values")
+	}
+}
@@ -0,0 +1,76 @@
+package context
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NegotiateFormat returns the offered media type that best matches the
+// request's Accept header, honoring q-values and wildcards. Ties go to the
+// earlier offer. Without an Accept header the first offer wins; "" means
+// nothing is acceptable.
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	accept := c.Request.Header.Get("Accept")
+	if accept == "" {
+		return offered[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value the Accept header gives to offer, using
+// the most specific matching media range.
+func acceptQuality(accept, offer string) float64 {
+	offerType, offerSub, _ := strings.Cut(offer, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		typ, sub, _ := strings.Cut(strings.TrimSpace(mediaRange), "/")
+
+		var s int
+		// Media types are case-insensitive (RFC 9110, section 8.3.1)
+		switch {
+		case typ == "*" && sub == "*":
+			s = 0
+		case strings.EqualFold(typ, offerType) && sub == "*":
+			s = 1
+		case strings.EqualFold(typ, offerType) && strings.EqualFold(sub, offerSub):
+			s = 2
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, parseQuality(params)
+	}
+	return q
+}
+
+// parseQuality reads "q=0.5" from media range parameters. Default: 1.
+func parseQuality(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.TrimSpace(k) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || q < 0 {
+			return 0
+		}
+		if q > 1 {
+			return 1
+		}
+		return q
+	}
+	return 1
+}
@@ -0,0 +1,281 @@
+package context
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMultipartMemory is the part of a multipart body kept in memory;
+// the rest of the files is stored on disk.
+const defaultMultipartMemory = 32 << 20 // 32MB
+
+// ErrMissingParam is wrapped by a ParamError for a param that is absent.
+var ErrMissingParam = errors.New("missing")
+
+// ParamError reports a path, query or form value that is missing or cannot
+// be converted. The engine's error handlers render it as a 400.
+type ParamError struct {
+	Source string // "path" or "query"
+	Key    string
+	Value  string
+	Type   string // the requested type, e.g. "int"
+	Err    error  // ErrMissingParam or the conversion error
+}
+
+// Error implements the error interface.
+func (e *ParamError) Error() string {
+	if errors.Is(e.Err, ErrMissingParam) {
+		return e.Source + " parameter " + strconv.Quote(e.Key) + " is missing"
+	}
+	return e.Source + " parameter " + strconv.Quote(e.Key) + ": " +
+		strconv.Quote(e.Value) + " is not a valid " + e.Type
+}
+
+// Unwrap returns the underlying error.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns 400.
+func (e *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// queryValues parses the URL query once per request.
+func (c *Context) queryValues() url.Values {
+	if c.queryCache == nil {
+		c.queryCache = c.Request.URL.Query()
+	}
+	return c.queryCache
+}
+
+// Query returns the first value of the URL query key, or "".
+//
+//	GET /search?q=kvolt&page=2
+//	c.Query("q") // "kvolt"
+func (c *Context) Query(key string) string {
+	value, _ := c.GetQuery(key)
+	return value
+}
+
+// GetQuery is like Query and also reports whether the key is present,
+// even with an empty value ("?q=").
+func (c *Context) GetQuery(key string) (string, bool) {
+	if values, ok := c.queryValues()[key]; ok && len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+// DefaultQuery returns the query value for key, or defaultValue when the
+// key is absent.
+func (c *Context) DefaultQuery(key, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// QueryArray returns every value of the query key ("?id=1&id=2").
+func (c *Context) QueryArray(key string) []string {
+	return c.queryValues()[key]
+}
+
+// QueryMap returns the query keys of the form key[name] as a map from name
+// to the first value: "?filter[status]=open&filter[owner]=me".
+func (c *Context) QueryMap(key string) map[string]string {
+	return bracketMap(c.queryValues(), key)
+}
+
+// postFormValues parses the urlencoded or multipart request body once.
+// A body that cannot be parsed has no values.
+func (c *Context) postFormValues() url.Values {
+	if c.formCache == nil {
+		r := c.Request
+		if r.PostForm == nil {
+			_ = r.ParseMultipartForm(defaultMultipartMemory) // errors leave the form empty
+		}
+		c.formCache = r.PostForm
+		if c.formCache == nil {
+			c.formCache = url.Values{}
+		}
+	}
+	return c.formCache
+}
+
+// PostForm returns the first value of key in a urlencoded or multipart
+// form body, or "". Query parameters are not included.
+func (c *Context) PostForm(key string) string {
+	value, _ := c.GetPostForm(key)
+	return value
+}
+
+// GetPostForm is like PostForm and also reports whether the key is present.
+func (c *Context) GetPostForm(key string) (string, bool) {
+	if values, ok := c.postFormValues()[key]; ok && len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+// DefaultPostForm returns the form value for key, or defaultValue when the
+// key is absent.
+func (c *Context) DefaultPostForm(key, defaultValue string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// PostFormArray returns every form value of key.
+func (c *Context) PostFormArray(key string) []string {
+	return c.postFormValues()[key]
+}
+
+// PostFormMap is QueryMap for the form body.
+func (c *Context) PostFormMap(key string) map[string]string {
+	return bracketMap(c.postFormValues(), key)
+}
+
+// bracketMap collects values["key[name]"] into a map keyed by name.
+func bracketMap(values url.Values, key string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range values {
+		name, ok := strings.CutPrefix(k, key+"[")
+		if !ok || len(v) == 0 {
+			continue
+		}
+		if name, ok = strings.CutSuffix(name, "]"); ok && name != "" {
+			m[name] = v[0]
+		}
+	}
+	return m
+}
+
+// Typed accessors. They return a *ParamError when the value is missing or
+// does not parse; returned from a handler, it becomes a 400 response.
+
+// ParamInt returns the path param key as an int.
+func (c *Context) ParamInt(key string) (int, error) {
+	value, ok := c.getParam(key)
+	return parseInt("path", key, value, ok)
+}
+
+// ParamInt64 returns the path param key as an int64.
+func (c *Context) ParamInt64(key string) (int64, error) {
+	value, ok := c.getParam(key)
+	return parseInt64("path", key, value, ok)
+}
+
+// QueryInt returns the query value key as an int.
+func (c *Context) QueryInt(key string) (int, error) {
+	value, ok := c.GetQuery(key)
+	return parseInt("query", key, value, ok)
+}
+
+// QueryInt64 returns the query value key as an int64.
+func (c *Context) QueryInt64(key string) (int64, error) {
+	value, ok := c.GetQuery(key)
+	return parseInt64("query", key, value, ok)
+}
+
+// QueryFloat64 returns the query value key as a float64.
+func (c *Context) QueryFloat64(key string) (float64, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return 0, missing("query", key, "float64")
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, invalid("query", key, value, "float64", err)
+	}
+	return f, nil
+}
+
+// QueryBool returns the query value key as a bool. It accepts the values
+// of strconv.ParseBool ("1", "t", "true", "0", "f", "false", ...); a key
+// without value ("?verbose") is true.
+func (c *Context) QueryBool(key string) (bool, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return false, missing("query", key, "bool")
+	}
+	if value == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, invalid("query", key, value, "bool", err)
+	}
+	return b, nil
+}
+
+// QueryTime parses the query value key with layout, e.g. time.RFC3339 or
+// time.DateOnly.
+func (c *Context) QueryTime(key, layout string) (time.Time, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return time.Time{}, missing("query", key, "time")
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, invalid("query", key, value, "time ("+layout+")", err)
+	}
+	return t, nil
+}
+
+// QueryDuration parses the query value key with time.ParseDuration ("1m30s").
+func (c *Context) QueryDuration(key string) (time.Duration, error) {
+	value, ok := c.GetQuery(key)
+	if !ok {
+		return 0, missing("query", key, "duration")
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, invalid("query", key, value, "duration", err)
+	}
+	return d, nil
+}
+
+func (c *Context) getParam(key string) (string, bool) {
+	for _, p := range c.Params {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func parseInt(source, key, value string, ok bool) (int, error) {
+	if !ok {
+		return 0, missing(source, key, "int")
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalid(source, key, value, "int", err)
+	}
+	return n, nil
+}
+
+func parseInt64(source, key, value string, ok bool) (int64, error) {
+	if !ok {
+		return 0, missing(source, key, "int64")
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, invalid(source, key, value, "int64", err)
+	}
+	return n, nil
+}
+
+func missing(source, key, typ string) *ParamError {
+	return &ParamError{Source: source, Key: key, Type: typ, Err: ErrMissingParam}
+}
+
+func invalid(source, key, value, typ string, err error) *ParamError {
+	return &ParamError{Source: source, Key: key, Value: value, Type: typ, Err: err}
+}
@@ -0,0 +1,430 @@
+package context
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+	"go.yaml.in/yaml/v3"
+)
+
+// Renderer encodes a response body in one media type.
+type Renderer interface {
+	// ContentType is the Content-Type header sent with the body.
+	ContentType() string
+	// Render writes obj to w.
+	Render(w io.Writer, obj interface{}) error
+}
+
+// Built-in renderers. NDJSON and CSV stream: they accept a slice, an array,
+// a channel or an iterator (iter.Seq) and flush after every value received
+// from a channel or iterator. CSV rows are []string values or structs,
+// whose fields give a header row named by their csv or json tags.
+var (
+	RenderJSON      Renderer = jsonRender{}      // <, > and & escaped as \u003c, \u003e, \u0026
+	RenderPureJSON  Renderer = pureJSONRender{}  // <, > and & are never escaped
+	RenderAsciiJSON Renderer = asciiJSONRender{} // non-ASCII escaped as \uXXXX
+	RenderXML       Renderer = xmlRender{}
+	RenderYAML      Renderer = yamlRender{}
+	RenderNDJSON    Renderer = ndjsonRender{}
+	RenderCSV       Renderer = csvRender{}
+)
+
+// Renderers is the set of renderers Negotiate picks from, keyed by media
+// type. The Engine holds one, see Engine.RegisterRenderer.
+type Renderers struct {
+	mu     sync.RWMutex
+	types  []string // registration order, the default offer order
+	byType map[string]Renderer
+}
+
+// NewRenderers returns a registry offering JSON, XML and YAML, in that order.
+func NewRenderers() *Renderers {
+	r := &Renderers{byType: make(map[string]Renderer)}
+	r.Register("application/json", RenderJSON)
+	r.Register("application/xml", RenderXML)
+	r.Register("application/yaml", RenderYAML)
+	return r
+}
+
+// Register makes Negotiate offer renderer for mediaType (e.g.
+// "application/msgpack"). It replaces any renderer registered for it,
+// keeping its place in the offer order.
+func (r *Renderers) Register(mediaType string, renderer Renderer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.byType[mediaType]; !ok {
+		r.types = append(r.types, mediaType)
+	}
+	r.byType[mediaType] = renderer
+}
+
+// Lookup returns the renderer registered for mediaType, or nil.
+func (r *Renderers) Lookup(mediaType string) Renderer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byType[mediaType]
+}
+
+// MediaTypes returns the registered media types in offer order.
+func (r *Renderers) MediaTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.types...)
+}
+
+// defaultRenderers serves contexts that were not created by an Engine.
+var defaultRenderers = NewRenderers()
+
+func (c *Context) renderers() *Renderers {
+	if c.Renderers != nil {
+		return c.Renderers
+	}
+	return defaultRenderers
+}
+
+// NotAcceptableError is returned by Negotiate when the Accept header allows
+// none of the offered media types. The engine's error handlers render it
+// as a 406.
+type NotAcceptableError struct {
+	Accept  string
+	Offered []string
+}
+
+// Error implements the error interface.
+func (e *NotAcceptableError) Error() string {
+	return "none of " + strings.Join(e.Offered, ", ") + " is acceptable"
+}
+
+// StatusCode returns 406.
+func (e *NotAcceptableError) StatusCode() int {
+	return http.StatusNotAcceptable
+}
+
+// Negotiate renders obj with the registered renderer that best matches the
+// Accept header (see NegotiateFormat). offers restricts the candidates to
+// these media types, in order of preference; by default every registered
+// renderer is offered. When none is acceptable nothing is written and a
+// *NotAcceptableError is returned.
+//
+//	return c.Negotiate(200, users, "application/json", "text/csv")
+func (c *Context) Negotiate(code int, obj interface{}, offers ...string) error {
+	registry := c.renderers()
+	if len(offers) == 0 {
+		offers = registry.MediaTypes()
+	}
+	available := make([]string, 0, len(offers))
+	for _, offer := range offers {
+		if registry.Lookup(offer) != nil {
+			available = append(available, offer)
+		}
+	}
+
+	mediaType := c.NegotiateFormat(available...)
+	if mediaType == "" {
+		return &NotAcceptableError{Accept: c.Request.Header.Get("Accept"), Offered: available}
+	}
+	return c.Render(code, registry.Lookup(mediaType), obj)
+}
+
+// Render writes obj with r and the given status code. Streaming renderers
+// (NDJSON, CSV) write to the response as they go, after the headers. Any
+// other renderer encodes into a buffer first, so when encoding fails
+// nothing is sent and the returned error still gets its own response.
+func (c *Context) Render(code int, r Renderer, obj interface{}) error {
+	if _, ok := r.(streamRenderer); ok {
+		c.Writer.Header().Set("Content-Type", r.ContentType())
+		c.Status(code)
+		return r.Render(c.Writer, obj)
+	}
+	var buf bytes.Buffer
+	if err := r.Render(&buf, obj); err != nil {
+		return err
+	}
+	c.Writer.Header().Set("Content-Type", r.ContentType())
+	c.Status(code)
+	_, err := c.Writer.Write(buf.Bytes())
+	return err
+}
+
+// streamRenderer is implemented by the renderers Render lets write to the
+// response directly.
+type streamRenderer interface {
+	stream()
+}
+
+// XML sends an XML response.
+func (c *Context) XML(code int, obj interface{}) error {
+	return c.Render(code, RenderXML, obj)
+}
+
+// YAML sends a YAML response.
+func (c *Context) YAML(code int, obj interface{}) error {
+	return c.Render(code, RenderYAML, obj)
+}
+
+// PureJSON sends a JSON response in which <, > and & are never escaped.
+func (c *Context) PureJSON(code int, obj interface{}) error {
+	return c.Render(code, RenderPureJSON, obj)
+}
+
+// AsciiJSON sends a JSON response with every non-ASCII character escaped.
+func (c *Context) AsciiJSON(code int, obj interface{}) error {
+	return c.Render(code, RenderAsciiJSON, obj)
+}
+
+// NDJSON streams obj as newline-delimited JSON, one line per element.
+//
+//	events := make(chan Event)
+//	go produce(events) // closes events when done
+//	return c.NDJSON(200, events)
+func (c *Context) NDJSON(code int, obj interface{}) error {
+	return c.Render(code, RenderNDJSON, obj)
+}
+
+// CSV streams obj as CSV: [][]string, or a sequence of structs with a
+// header row built from their tags.
+func (c *Context) CSV(code int, obj interface{}) error {
+	return c.Render(code, RenderCSV, obj)
+}
+
+// jsonpCallback matches the callback names JSONP accepts.
+var jsonpCallback = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+// JSONP sends obj wrapped in the function named by the "callback" query
+// parameter, or plain JSON without one. A callback that is not a
+// JavaScript identifier path is a 400 (*ParamError).
+func (c *Context) JSONP(code int, obj interface{}) error {
+	callback := c.Query("callback")
+	if callback == "" {
+		return c.JSON(code, obj)
+	}
+	if !jsonpCallback.MatchString(callback) {
+		return invalid("query", "callback", callback, "JavaScript identifier", errors.New("invalid callback"))
+	}
+	return c.Render(code, jsonpRender{callback}, obj)
+}
+
+type jsonRender struct{}
+
+func (jsonRender) ContentType() string { return "application/json" }
+
+func (jsonRender) Render(w io.Writer, obj interface{}) error {
+	enc := sonic.ConfigDefault.NewEncoder(w)
+	enc.SetEscapeHTML(true)
+	return enc.Encode(obj)
+}
+
+type pureJSONRender struct{}
+
+func (pureJSONRender) ContentType() string { return "application/json" }
+
+func (pureJSONRender) Render(w io.Writer, obj interface{}) error {
+	enc := sonic.ConfigDefault.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(obj)
+}
+
+type asciiJSONRender struct{}
+
+func (asciiJSONRender) ContentType() string { return "application/json" }
+
+func (asciiJSONRender) Render(w io.Writer, obj interface{}) error {
+	data, err := sonic.ConfigDefault.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, r := range string(data) {
+		if r < utf8.RuneSelf {
+			buf.WriteByte(byte(r))
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&buf, `\u%04x`, u)
+		}
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+type jsonpRender struct {
+	callback string
+}
+
+func (jsonpRender) ContentType() string { return "application/javascript" }
+
+func (r jsonpRender) Render(w io.Writer, obj interface{}) error {
+	data, err := sonic.ConfigDefault.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	// The leading comment stops the body from being sniffed as another format
+	_, err = fmt.Fprintf(w, "/**/%s(%s);", r.callback, data)
+	return err
+}
+
+type xmlRender struct{}
+
+func (xmlRender) ContentType() string { return "application/xml" }
+
+func (xmlRender) Render(w io.Writer, obj interface{}) error {
+	return xml.NewEncoder(w).Encode(obj)
+}
+
+type yamlRender struct{}
+
+func (yamlRender) ContentType() string { return "application/yaml" }
+
+func (yamlRender) Render(w io.Writer, obj interface{}) error {
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(obj); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+type ndjsonRender struct{}
+
+func (ndjsonRender) ContentType() string { return "application/x-ndjson" }
+
+func (ndjsonRender) stream() {}
+
+func (ndjsonRender) Render(w io.Writer, obj interface{}) error {
+	enc := sonic.ConfigDefault.NewEncoder(w)
+	return each(obj, func(v reflect.Value) error {
+		return enc.Encode(v.Interface())
+	}, flusher(w))
+}
+
+type csvRender struct{}
+
+func (csvRender) ContentType() string { return "text/csv" }
+
+func (csvRender) stream() {}
+
+func (csvRender) Render(w io.Writer, obj interface{}) error {
+	cw := csv.NewWriter(w)
+	flush := flusher(w)
+	var columns []int // struct field indexes, set with the header row
+	err := each(obj, func(v reflect.Value) error {
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if row, ok := v.Interface().([]string); ok {
+			return cw.Write(row)
+		}
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("kvolt: cannot render %s as a CSV row", v.Type())
+		}
+		if columns == nil {
+			var header []string
+			header, columns = csvHeader(v.Type())
+			if err := cw.Write(header); err != nil {
+				return err
+			}
+		}
+		record := make([]string, len(columns))
+		for i, field := range columns {
+			record[i] = csvValue(v.Field(field))
+		}
+		return cw.Write(record)
+	}, func() {
+		cw.Flush()
+		flush()
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvHeader returns the column names and field indexes of the exported
+// fields of t, named by their csv tag, then json tag, then Go name.
+func csvHeader(t reflect.Type) (header []string, columns []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("csv"); ok {
+			name, _, _ = strings.Cut(tag, ",")
+		} else if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag, _, _ = strings.Cut(tag, ","); tag != "" {
+				name = tag
+			}
+		}
+		if name == "-" {
+			continue
+		}
+		header = append(header, name)
+		columns = append(columns, i)
+	}
+	return header, columns
+}
+
+// csvValue formats a field with MarshalText when available, fmt otherwise.
+func csvValue(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// each calls fn for every element of a slice, array, channel or iterator
+// obj, and flush after each element received from a channel or iterator.
+// Any other value is a single element.
+func each(obj interface{}, fn func(reflect.Value) error, flush func()) error {
+	v := reflect.ValueOf(obj)
+	switch v.Kind() {
+	case reflect.Invalid:
+		v = reflect.ValueOf(&obj).Elem() // nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := fn(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Chan, reflect.Func:
+		if !v.Type().CanSeq() {
+			break
+		}
+		for elem := range v.Seq() {
+			if err := fn(elem); err != nil {
+				return err
+			}
+			flush()
+		}
+		return nil
+	}
+	return fn(v)
+}
+
+// flusher returns a func flushing w if it is an http.Flusher.
+func flusher(w io.Writer) func() {
+	if f, ok := w.(http.Flusher); ok {
+		return f.Flush
+	}
+	return func() {}
+}
@@ -0,0 +1,173 @@
+package context
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter is the writer of a Context. On top of http.ResponseWriter
+// it records the status and size of the response and runs Before hooks
+// just before the headers are sent. It forwards Flush, Hijack, Push and
+// ReadFrom to the writer it wraps, so WebSockets and streams work behind
+// any middleware.
+//
+// Middleware that replaces c.Writer (e.g. to compress the body) should
+// embed the current ResponseWriter and override Write and ReadFrom, so
+// status tracking and hooks keep working.
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	io.ReaderFrom
+
+	// Status returns the status code sent, or 200 before the headers are sent.
+	Status() int
+	// Size returns the number of body bytes written.
+	Size() int
+	// Written reports whether the headers have been sent.
+	Written() bool
+	// Before registers fn to run just before the headers are sent, e.g. to
+	// set a header that depends on the response. Hooks run in registration
+	// order.
+	Before(fn func())
+	// Unwrap returns the wrapped writer, for http.ResponseController.
+	Unwrap() http.ResponseWriter
+}
+
+// NewResponseWriter wraps w, or returns it when it already is a
+// ResponseWriter.
+func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
+	if rw, ok := w.(ResponseWriter); ok {
+		return rw
+	}
+	rw := &responseWriter{}
+	rw.reset(w)
+	return rw
+}
+
+type responseWriter struct {
+	w        http.ResponseWriter
+	status   int
+	size     int
+	written  bool
+	hijacked bool
+	before   []func()
+}
+
+func (w *responseWriter) reset(rw http.ResponseWriter) {
+	w.w = rw
+	w.status = http.StatusOK
+	w.size = 0
+	w.written = false
+	w.hijacked = false
+	clear(w.before)
+	w.before = w.before[:0]
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+// WriteHeader sends the headers once; later calls are ignored.
+// Informational (1xx) headers other than 101 are passed through.
+func (w *responseWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.w.WriteHeader(code)
+		return
+	}
+	w.writeHeader(code)
+}
+
+func (w *responseWriter) writeHeader(code int) {
+	for _, fn := range w.before {
+		fn()
+	}
+	w.status = code
+	w.written = true
+	w.w.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !w.written {
+		w.writeHeader(http.StatusOK)
+	}
+	n, err := w.w.Write(b)
+	w.size += n
+	return n, err
+}
+
+// ReadFrom lets io.Copy use the wrapped writer's ReadFrom (sendfile for
+// *os.File bodies).
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	if !w.written {
+		w.writeHeader(http.StatusOK)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{w.w}, r) // hide ReadFrom from io.Copy
+	}
+	w.size += int(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.written {
+		w.writeHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.w).Flush()
+}
+
+// Hijack takes over the connection; the response counts as written and
+// later writes fail with http.ErrHijacked.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.w).Hijack()
+	if err == nil {
+		w.written, w.hijacked = true, true
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.written
+}
+
+func (w *responseWriter) Before(fn func()) {
+	w.before = append(w.before, fn)
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
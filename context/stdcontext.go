@@ -0,0 +1,56 @@
+package context
+
+import (
+	stdContext "context"
+	"time"
+)
+
+// Context implements the standard context.Context, so it can be passed
+// straight to database drivers and clients:
+//
+//	rows, err := db.QueryContext(c, "SELECT ...")
+//
+// Deadline, Done and Err are those of the request's context. Value looks
+// up string keys in Keys (see Set) before the request's context. Like the
+// rest of Context, it is only valid until the handler returns; pass
+// c.Request.Context() or c.Copy() to goroutines that outlive it.
+var _ stdContext.Context = (*Context)(nil)
+
+// Deadline returns the deadline of the request's context, if any.
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Request == nil {
+		return time.Time{}, false
+	}
+	return c.Request.Context().Deadline()
+}
+
+// Done returns a channel closed when the request is canceled (the client
+// went away) or its deadline passes.
+func (c *Context) Done() <-chan struct{} {
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Done()
+}
+
+// Err reports why Done was closed, or nil.
+func (c *Context) Err() error {
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Err()
+}
+
+// Value returns c.Keys[key] for a string key that was Set, otherwise the
+// value of the request's context.
+func (c *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v, exists := c.Get(k); exists {
+			return v
+		}
+	}
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Value(key)
+}
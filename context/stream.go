@@ -0,0 +1,260 @@
+package context
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// DefaultHeartbeat is the interval of the comments StreamEvents sends to
+// keep idle connections (and proxies) open.
+const DefaultHeartbeat = 15 * time.Second
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID is sent back by a reconnecting client in the Last-Event-ID header.
+	ID string
+	// Event is the event type; browsers dispatch it to addEventListener(Event).
+	// Empty means "message".
+	Event string
+	// Data is sent as is when it is a string or []byte, as JSON otherwise.
+	Data interface{}
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventReplay returns the events a reconnecting client missed.
+type EventReplay interface {
+	// Since returns the events sent after the one with the given ID, oldest
+	// first.
+	Since(lastEventID string) []Event
+}
+
+// EventBuffer is an EventReplay that keeps the last events in memory.
+// Publishers Add every event they send; it is safe for concurrent use.
+type EventBuffer struct {
+	mu     sync.Mutex
+	size   int
+	events []Event
+}
+
+// NewEventBuffer returns a buffer keeping the last size events.
+func NewEventBuffer(size int) *EventBuffer {
+	return &EventBuffer{size: size}
+}
+
+// Add records ev, dropping the oldest event when the buffer is full.
+func (b *EventBuffer) Add(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, ev)
+	if len(b.events) > b.size {
+		b.events = b.events[len(b.events)-max(b.size, 0):]
+	}
+}
+
+// Since returns the events after lastEventID. An ID that is no longer (or
+// was never) buffered returns every buffered event; an empty ID none.
+func (b *EventBuffer) Since(lastEventID string) []Event {
+	if lastEventID == "" {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := 0
+	for i := len(b.events) - 1; i >= 0; i-- {
+		if b.events[i].ID == lastEventID {
+			start = i + 1
+			break
+		}
+	}
+	return append([]Event(nil), b.events[start:]...)
+}
+
+// StreamConfig configures StreamEvents.
+type StreamConfig struct {
+	// Heartbeat is the interval of keep-alive comments.
+	// Default: DefaultHeartbeat; negative disables them.
+	Heartbeat time.Duration
+	// Replay, when set, resends the events a client missed according to
+	// its Last-Event-ID header before the first new event.
+	Replay EventReplay
+}
+
+// LastEventID returns the ID of the last event a reconnecting client
+// received, from the Last-Event-ID header.
+func (c *Context) LastEventID() string {
+	return c.Request.Header.Get("Last-Event-ID")
+}
+
+// SSE sends one Server-Sent Event and flushes it. The event-stream headers
+// are sent with the first event.
+//
+//	c.SSE("price", Quote{Symbol: "KV", Price: 42})
+func (c *Context) SSE(event string, data interface{}) error {
+	return c.SendEvent(Event{Event: event, Data: data})
+}
+
+// SendEvent is SSE with an ID and retry delay.
+func (c *Context) SendEvent(ev Event) error {
+	c.startStream("text/event-stream")
+	if err := writeEvent(c.Writer, ev); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+// StreamEvents sends the events received from events until the channel is
+// closed, the client disconnects or the engine shuts down, sending a
+// heartbeat comment when idle. With config.Replay, the events missed
+// since Last-Event-ID are sent first. It returns nil unless a write fails.
+//
+//	return c.StreamEvents(hub.Subscribe(), context.StreamConfig{Replay: hub.Buffer})
+func (c *Context) StreamEvents(events <-chan Event, config StreamConfig) error {
+	c.startStream("text/event-stream")
+	if config.Replay != nil {
+		for _, ev := range config.Replay.Since(c.LastEventID()) {
+			if err := writeEvent(c.Writer, ev); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	if config.Heartbeat == 0 {
+		config.Heartbeat = DefaultHeartbeat
+	}
+	var heartbeat <-chan time.Time
+	if config.Heartbeat > 0 {
+		ticker := time.NewTicker(config.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-c.Request.Context().Done():
+			return nil
+		case <-c.Closing:
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			err = writeEvent(c.Writer, ev)
+		case <-heartbeat:
+			_, err = io.WriteString(c.Writer, ": ping\n\n")
+		}
+		if err == nil {
+			err = c.flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Stream calls step repeatedly, flushing after each call, until step
+// returns false, the client disconnects or the engine shuts down. It
+// reports whether the stream was cut short by one of the latter two.
+//
+//	c.Stream(func(w io.Writer) bool {
+//		line, ok := <-lines
+//		if ok {
+//			fmt.Fprintln(w, line)
+//		}
+//		return ok
+//	})
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	c.startStream("")
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return true
+		case <-c.Closing:
+			return true
+		default:
+		}
+		keepOpen := step(c.Writer)
+		if err := c.flush(); err != nil {
+			return true
+		}
+		if !keepOpen {
+			return false
+		}
+	}
+}
+
+// startStream sends the headers of a streamed response and lifts the
+// server's write timeout, which would otherwise cut the stream. contentType
+// is set unless empty or already set.
+func (c *Context) startStream(contentType string) {
+	if c.Writer.Written() {
+		return
+	}
+	h := c.Writer.Header()
+	if contentType != "" && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", contentType)
+	}
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Status(http.StatusOK)
+}
+
+// flush sends buffered data to the client through any writer wrappers
+// that support it.
+func (c *Context) flush() error {
+	err := http.NewResponseController(c.Writer).Flush()
+	if err == http.ErrNotSupported {
+		return nil
+	}
+	return err
+}
+
+// eventField strips line breaks, which would end the field early.
+var eventField = strings.NewReplacer("\r\n", "", "\r", "", "\n", "")
+
+// writeEvent writes ev in the text/event-stream format.
+func writeEvent(w io.Writer, ev Event) error {
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + eventField.Replace(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + eventField.Replace(ev.Event) + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	var data string
+	switch d := ev.Data.(type) {
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		encoded, err := sonic.ConfigDefault.MarshalToString(d)
+		if err != nil {
+			return err
+		}
+		data = encoded
+	}
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,192 @@
+package context
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/locales/de"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	"github.com/go-playground/locales/it"
+	"github.com/go-playground/locales/ja"
+	"github.com/go-playground/locales/nl"
+	"github.com/go-playground/locales/pt"
+	"github.com/go-playground/locales/pt_BR"
+	"github.com/go-playground/locales/ru"
+	"github.com/go-playground/locales/tr"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	de_translations "github.com/go-playground/validator/v10/translations/de"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+	it_translations "github.com/go-playground/validator/v10/translations/it"
+	ja_translations "github.com/go-playground/validator/v10/translations/ja"
+	nl_translations "github.com/go-playground/validator/v10/translations/nl"
+	pt_translations "github.com/go-playground/validator/v10/translations/pt"
+	pt_BR_translations "github.com/go-playground/validator/v10/translations/pt_BR"
+	ru_translations "github.com/go-playground/validator/v10/translations/ru"
+	tr_translations "github.com/go-playground/validator/v10/translations/tr"
+	zh_translations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// FieldError describes one failed validation rule.
+type FieldError struct {
+	// Field is the path of the field named by its json (or form, query,
+	// uri, header) tag, e.g. "items[2].email".
+	Field string `json:"field"`
+	// Rule is the validate tag that failed, e.g. "email" or "min".
+	Rule string `json:"rule"`
+	// Param is the rule parameter, e.g. "3" for "min=3".
+	Param string `json:"param,omitempty"`
+	// Message is the human-readable message in the request's locale.
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by Validate and the Bind methods when the
+// "validate" tags fail. The engine's error handlers render it as a 422
+// problem response listing Fields.
+type ValidationError struct {
+	Fields []FieldError
+	// Locale is the locale the messages are written in, e.g. "de".
+	Locale string
+
+	errs validator.ValidationErrors
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the validator.ValidationErrors the error was built from.
+func (e *ValidationError) Unwrap() error {
+	return e.errs
+}
+
+// StatusCode returns 422.
+func (e *ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Validate runs the struct validator ("validate" tags) on obj. Failures
+// are returned as a *ValidationError whose messages are translated to the
+// best language of the Accept-Language header (English by default).
+func (c *Context) Validate(obj interface{}) error {
+	err := validate.Struct(obj)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	var acceptLanguage string
+	if c.Request != nil {
+		acceptLanguage = c.Request.Header.Get("Accept-Language")
+	}
+	trans, _ := translator.FindTranslator(acceptedLanguages(acceptLanguage)...)
+	ve := &ValidationError{
+		Fields: make([]FieldError, len(errs)),
+		Locale: trans.Locale(),
+		errs:   errs,
+	}
+	for i, fe := range errs {
+		field := fe.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest // drop the top-level struct name
+		}
+		ve.Fields[i] = FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fe.Translate(trans),
+		}
+	}
+	return ve
+}
+
+// translator holds the locales validation messages are available in.
+// English is the fallback.
+var translator = ut.New(en.New(), en.New(), de.New(), es.New(), fr.New(), it.New(),
+	ja.New(), nl.New(), pt.New(), pt_BR.New(), ru.New(), tr.New(), zh.New())
+
+// newValidator returns a validator that names fields after their tags
+// rather than Go names and has the messages of every locale of translator.
+// It must be fully set up before first use, as the validator caches struct
+// metadata, field names included.
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(fieldName)
+	for locale, register := range map[string]func(*validator.Validate, ut.Translator) error{
+		"en":    en_translations.RegisterDefaultTranslations,
+		"de":    de_translations.RegisterDefaultTranslations,
+		"es":    es_translations.RegisterDefaultTranslations,
+		"fr":    fr_translations.RegisterDefaultTranslations,
+		"it":    it_translations.RegisterDefaultTranslations,
+		"ja":    ja_translations.RegisterDefaultTranslations,
+		"nl":    nl_translations.RegisterDefaultTranslations,
+		"pt":    pt_translations.RegisterDefaultTranslations,
+		"pt_BR": pt_BR_translations.RegisterDefaultTranslations,
+		"ru":    ru_translations.RegisterDefaultTranslations,
+		"tr":    tr_translations.RegisterDefaultTranslations,
+		"zh":    zh_translations.RegisterDefaultTranslations,
+	} {
+		trans, _ := translator.GetTranslator(locale)
+		if err := register(validate, trans); err != nil {
+			panic("kvolt: registering " + locale + " validation messages: " + err.Error())
+		}
+	}
+	return validate
+}
+
+// fieldName names a field after the first of its json, form, query, uri
+// and header tags, falling back to the Go name.
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form", "query", "uri", "header"} {
+		name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return ""
+}
+
+// acceptedLanguages returns the locales of an Accept-Language header by
+// decreasing preference, in translator form: "de-DE" gives "de_DE" then
+// "de". Languages with q=0 and the "*" wildcard are left out.
+func acceptedLanguages(header string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var langs []lang
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		if q := parseQuality(params); q > 0 {
+			langs = append(langs, lang{tag, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	locales := make([]string, 0, 2*len(langs))
+	for _, l := range langs {
+		locale := strings.ReplaceAll(l.tag, "-", "_")
+		locales = append(locales, locale)
+		if base, _, ok := strings.Cut(locale, "_"); ok {
+			locales = append(locales, base)
+		}
+	}
+	return locales
+}
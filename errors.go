@@ -0,0 +1,168 @@
+package kvolt
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/bytedance/sonic"
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// HTTPError is an error that carries an HTTP status.
+// Handlers return it to control the response rendered by the error handler.
+type HTTPError struct {
+	// Status is the HTTP status code (e.g. 404).
+	Status int
+	// Code is an optional machine-readable error code (e.g. "user_not_found").
+	Code string
+	// Message is the client-facing message. Defaults to the status text.
+	Message string
+	// Internal is the underlying cause. It is logged, never sent to the client.
+	Internal error
+}
+
+// Common errors, rendered by the error handler.
+var (
+	ErrBadRequest          = NewHTTPError(http.StatusBadRequest)
+	ErrUnauthorized        = NewHTTPError(http.StatusUnauthorized)
+	ErrForbidden           = NewHTTPError(http.StatusForbidden)
+	ErrNotFound            = NewHTTPError(http.StatusNotFound)
+	ErrMethodNotAllowed    = NewHTTPError(http.StatusMethodNotAllowed)
+	ErrNotAcceptable       = NewHTTPError(http.StatusNotAcceptable)
+	ErrUnprocessableEntity = NewHTTPError(http.StatusUnprocessableEntity)
+	ErrInternalServerError = NewHTTPError(http.StatusInternalServerError)
+)
+
+// NewHTTPError creates an HTTPError. The message defaults to the status text.
+func NewHTTPError(status int, message ...string) *HTTPError {
+	e := &HTTPError{Status: status, Message: http.StatusText(status)}
+	if len(message) > 0 {
+		e.Message = message[0]
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	if e.Internal != nil {
+		return fmt.Sprintf("status=%d, message=%s, internal=%v", e.Status, e.Message, e.Internal)
+	}
+	return fmt.Sprintf("status=%d, message=%s", e.Status, e.Message)
+}
+
+// Unwrap returns the internal cause so errors.Is/As see through HTTPError.
+func (e *HTTPError) Unwrap() error {
+	return e.Internal
+}
+
+// WithCode returns a copy of the error with the machine-readable code set.
+func (e *HTTPError) WithCode(code string) *HTTPError {
+	cp := *e
+	cp.Code = code
+	return &cp
+}
+
+// WithInternal returns a copy of the error with the internal cause set.
+func (e *HTTPError) WithInternal(err error) *HTTPError {
+	cp := *e
+	cp.Internal = err
+	return &cp
+}
+
+// ValidationError is returned when the "validate" tags of a bound request
+// fail. Both error handlers render it as a 422 problem response whose
+// "errors" member lists the FieldErrors.
+type ValidationError = context.ValidationError
+
+// FieldError is one failed rule of a ValidationError.
+type FieldError = context.FieldError
+
+// ErrorHandler renders an error returned from the handler chain.
+type ErrorHandler func(c *context.Context, err error)
+
+// toHTTPError maps any error to an HTTPError. A *context.StatusError (from
+// AbortWithError) keeps its status and hides its cause. Other errors
+// implementing StatusCoder (e.g. *context.ParamError, *context.BindError)
+// keep their status and message; the rest become a 500 with the original
+// error as internal cause.
+func toHTTPError(err error) *HTTPError {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	var se *context.StatusError
+	if errors.As(err, &se) {
+		return NewHTTPError(se.Status).WithInternal(se.Err)
+	}
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return NewHTTPError(sc.StatusCode(), err.Error()).WithInternal(err)
+	}
+	return ErrInternalServerError.WithInternal(err)
+}
+
+// logError logs server-side failures; client errors are not logged.
+func logError(he *HTTPError) {
+	if he.Status >= http.StatusInternalServerError {
+		log.Printf("[KVolt] handler error: %v", he)
+	}
+}
+
+// DefaultErrorHandler renders errors as JSON: {"error": "...", "code": "..."}.
+// Internal causes are never exposed. Nothing is written if the response has started.
+// A ValidationError is rendered by ProblemErrorHandler.
+func DefaultErrorHandler(c *context.Context, err error) {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		ProblemErrorHandler(c, err)
+		return
+	}
+	he := toHTTPError(err)
+	logError(he)
+	if c.HeaderWritten() {
+		return
+	}
+
+	body := map[string]string{"error": he.Message}
+	if he.Code != "" {
+		body["code"] = he.Code
+	}
+	_ = c.JSON(he.Status, body)
+}
+
+// ProblemErrorHandler renders errors as RFC 7807 "application/problem+json".
+// Use it with Engine.SetErrorHandler. A ValidationError adds an "errors"
+// member with one entry per failed field:
+//
+//	{"field": "items[2].email", "rule": "email", "message": "..."}
+func ProblemErrorHandler(c *context.Context, err error) {
+	he := toHTTPError(err)
+	logError(he)
+	if c.HeaderWritten() {
+		return
+	}
+
+	problem := map[string]interface{}{
+		"type":   "about:blank",
+		"title":  http.StatusText(he.Status),
+		"status": he.Status,
+	}
+	if he.Message != "" && he.Message != http.StatusText(he.Status) {
+		problem["detail"] = he.Message
+	}
+	if he.Code != "" {
+		problem["code"] = he.Code
+	}
+	if c.Request != nil {
+		problem["instance"] = c.Request.URL.Path
+	}
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		problem["errors"] = ve.Fields
+	}
+	c.Writer.Header().Set("Content-Type", "application/problem+json")
+	c.Status(he.Status)
+	_ = sonic.ConfigDefault.NewEncoder(c.Writer).Encode(problem)
+}
@@ -6,11 +6,13 @@ import (
 
 	"github.com/go-kvolt/kvolt"
 	"github.com/go-kvolt/kvolt/context"
+	"github.com/go-kvolt/kvolt/middleware"
 	"github.com/go-kvolt/kvolt/pkg/queue"
 )
 
 func main() {
 	app := kvolt.New()
+	app.Use(middleware.Logger())
 
 	// 1. Initialize Queue (100 buffer, 2 workers for demo)
 	q := queue.NewMemoryQueue(100, 2)
@@ -24,9 +26,9 @@ func main() {
 		return nil
 	})
 
-	// 3. Start Queue
-	q.Start()
-	defer q.Stop()
+	// 3. Start the queue with the app and stop it after in-flight requests drain
+	app.Manage("queue", q)
+	app.OnShutdown(middleware.FlushLogs)
 
 	// 4. API Endpoints
 	app.POST("/send", func(c *context.Context) error {
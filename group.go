@@ -1,63 +1,197 @@
 package kvolt
 
 import (
+	"errors"
 	"net/http"
+	"slices"
+	"sync/atomic"
 
 	"github.com/go-kvolt/kvolt/context"
+	"github.com/go-kvolt/kvolt/router"
 )
 
 // RouterGroup is a wrapper to group routes with a common prefix and middleware.
 type RouterGroup struct {
 	prefix     string
-	middleware []context.HandlerFunc
-	engine     *Engine // Recursive ref to register final route
+	middleware []context.HandlerFunc // this group's own middleware, not the parent's
+	parent     *RouterGroup          // nil for the engine's root group
+	host       *hostRouter           // set for groups created by Engine.Host
+	engine     *Engine               // Recursive ref to register final route
 }
 
 // Group creates a new child group.
+// The child inherits the parent's middleware when chains are compiled,
+// including middleware the parent adds later.
 func (group *RouterGroup) Group(prefix string) *RouterGroup {
 	return &RouterGroup{
-		prefix:     group.prefix + prefix,
-		middleware: group.middleware, // Inherit parent middleware
-		engine:     group.engine,
+		prefix: group.prefix + prefix,
+		parent: group,
+		host:   group.host,
+		engine: group.engine,
 	}
 }
 
-// Use adds middleware to the group.
+// Use adds middleware to the group. It applies to every route of the group
+// and its child groups, whether they are registered before or after the call.
 func (group *RouterGroup) Use(h ...context.HandlerFunc) {
+	e := group.engine
+	e.buildMu.Lock()
 	group.middleware = append(group.middleware, h...)
+	e.buildMu.Unlock()
+	e.invalidate()
+}
+
+// collectMiddleware returns the middleware of the group's ancestors and the
+// group itself, outermost first, in a freshly allocated slice. The caller
+// holds the engine's buildMu.
+func (group *RouterGroup) collectMiddleware() []context.HandlerFunc {
+	var groups []*RouterGroup
+	n := 0
+	for g := group; g != nil; g = g.parent {
+		groups = append(groups, g)
+		n += len(g.middleware)
+	}
+	middleware := make([]context.HandlerFunc, 0, n)
+	for i := len(groups) - 1; i >= 0; i-- {
+		middleware = append(middleware, groups[i].middleware...)
+	}
+	return middleware
 }
 
 // Route represents a registered route.
 type Route struct {
 	Method string
 	Path   string
+	// Host is the Engine.Host pattern the route belongs to, or "".
+	Host string
+	// Source is the file:line where the route was registered.
+	Source string
 	engine *Engine
+	router *router.Router // the host's tree or the fallback tree
+	name   string
+
+	group      *RouterGroup
+	middleware []context.HandlerFunc // added with Route.Use, guarded by the engine's buildMu
+	handlers   []context.HandlerFunc // handlers passed at registration
+	// chain is compiled by Engine.Build and replaced, never changed, so
+	// requests read it without locking
+	chain atomic.Pointer[[]context.HandlerFunc]
+
+	// typed is set by Typed
+	typed *typedHandler
+	// detached is set when the route could not be inserted (see
+	// Engine.Validate) or was removed or replaced; Name, Desc and Use do
+	// nothing then. It is set under the engine's routesMu.
+	detached atomic.Bool
+}
+
+// Use adds middleware to this route only. It runs after the group
+// middleware and before the route's handlers.
+func (r *Route) Use(middleware ...context.HandlerFunc) *Route {
+	if r.detached.Load() {
+		return r
+	}
+	e := r.engine
+	e.buildMu.Lock()
+	r.middleware = append(r.middleware, middleware...)
+	e.buildMu.Unlock()
+	e.invalidate()
+	return r
+}
+
+// compile builds the chain: group middleware (outermost group first),
+// route middleware, then handlers. The caller holds the engine's buildMu.
+func (r *Route) compile() {
+	chain := r.group.collectMiddleware()
+	chain = append(chain, r.middleware...)
+	chain = append(chain, r.handlers...)
+	r.chain.Store(&chain)
+}
+
+// handlerChain returns the compiled chain.
+func (r *Route) handlerChain() []context.HandlerFunc {
+	return *r.chain.Load()
+}
+
+// Handlers returns the route's effective handler chain.
+func (r *Route) Handlers() []context.HandlerFunc {
+	r.engine.Build()
+	return r.handlerChain()
 }
 
 // Desc adds a description/summary to the route for documentation.
 func (r *Route) Desc(summary string) *Route {
-	r.engine.router.SetDocumentation(r.Method, r.Path, summary)
+	if r.detached.Load() {
+		return r // the path may belong to the route it conflicts with
+	}
+	r.router.SetDocumentation(r.Method, r.Path, summary)
 	return r
 }
 
 // GET adds a GET route to the group.
-func (group *RouterGroup) GET(path string, handler context.HandlerFunc) *Route {
-	return group.addRoute("GET", path, handler)
+func (group *RouterGroup) GET(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("GET", path, handlers)
 }
 
 // POST adds a POST route to the group.
-func (group *RouterGroup) POST(path string, handler context.HandlerFunc) *Route {
-	return group.addRoute("POST", path, handler)
+func (group *RouterGroup) POST(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("POST", path, handlers)
 }
 
 // PUT adds a PUT route to the group.
-func (group *RouterGroup) PUT(path string, handler context.HandlerFunc) *Route {
-	return group.addRoute("PUT", path, handler)
+func (group *RouterGroup) PUT(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("PUT", path, handlers)
 }
 
 // DELETE adds a DELETE route to the group.
-func (group *RouterGroup) DELETE(path string, handler context.HandlerFunc) *Route {
-	return group.addRoute("DELETE", path, handler)
+func (group *RouterGroup) DELETE(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("DELETE", path, handlers)
+}
+
+// PATCH adds a PATCH route to the group.
+func (group *RouterGroup) PATCH(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("PATCH", path, handlers)
+}
+
+// HEAD adds a HEAD route to the group.
+// GET routes already answer HEAD requests; register HEAD only to override that.
+func (group *RouterGroup) HEAD(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("HEAD", path, handlers)
+}
+
+// OPTIONS adds an OPTIONS route to the group.
+// Without one, OPTIONS requests are answered automatically with an Allow header.
+func (group *RouterGroup) OPTIONS(path string, handlers ...context.HandlerFunc) *Route {
+	return group.addRoute("OPTIONS", path, handlers)
+}
+
+// Handle adds a route for an arbitrary HTTP method (e.g. "PROPFIND").
+func (group *RouterGroup) Handle(method, path string, handlers ...context.HandlerFunc) *Route {
+	if method == "" {
+		panic("kvolt: HTTP method can not be empty")
+	}
+	return group.addRoute(method, path, handlers)
+}
+
+// anyMethods is the method set registered by Any.
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete,
+	http.MethodConnect, http.MethodTrace,
+}
+
+// Any registers the handlers for all standard HTTP methods.
+func (group *RouterGroup) Any(path string, handlers ...context.HandlerFunc) []*Route {
+	return group.Match(anyMethods, path, handlers...)
+}
+
+// Match registers the handlers for each of the given HTTP methods.
+func (group *RouterGroup) Match(methods []string, path string, handlers ...context.HandlerFunc) []*Route {
+	routes := make([]*Route, 0, len(methods))
+	for _, method := range methods {
+		routes = append(routes, group.Handle(method, path, handlers...))
+	}
+	return routes
 }
 
 // Static registers a route to serve static files from the provided root directory.
@@ -68,12 +202,7 @@ func (group *RouterGroup) Static(relativePath, root string) *Route {
 	absolutePrefix := group.prefix + relativePath
 
 	// Create the file server handler
-	fs := http.StripPrefix(absolutePrefix, http.FileServer(http.Dir(root)))
-
-	handler := func(c *context.Context) error {
-		fs.ServeHTTP(c.Writer, c.Request)
-		return nil
-	}
+	handler := WrapH(http.StripPrefix(absolutePrefix, http.FileServer(http.Dir(root))))
 
 	// Register the route with wildcard suffix
 	// e.g. /assets/*filepath
@@ -89,19 +218,126 @@ func (group *RouterGroup) Static(relativePath, root string) *Route {
 	return group.GET(urlPattern, handler)
 }
 
-func (group *RouterGroup) addRoute(method, path string, handler context.HandlerFunc) *Route {
-	fullPath := group.prefix + path
+// addRoute registers handlers for method and path. A route that cannot be
+// inserted is recorded for Engine.Validate instead, and the returned route
+// is detached: it serves nothing and ignores Name, Desc and Use.
+func (group *RouterGroup) addRoute(method, path string, handlers []context.HandlerFunc) *Route {
+	route, err := group.insertRoute(method, path, handlers)
+	if err != nil {
+		route.detached.Store(true)
+		group.engine.routesMu.Lock()
+		group.engine.routeErrors = append(group.engine.routeErrors, err)
+		group.engine.routesMu.Unlock()
+	}
+	return route
+}
 
-	// Combine middleware: Group Middleware + Route Handler
-	handlers := make([]context.HandlerFunc, 0, len(group.middleware)+1)
-	handlers = append(handlers, group.middleware...)
-	handlers = append(handlers, handler)
+// insertRoute registers handlers for method and path. The route's chain is
+// compiled before it is published, so it can be served right away.
+func (group *RouterGroup) insertRoute(method, path string, handlers []context.HandlerFunc) (*Route, *RouteError) {
+	route := group.newRoute(method, path, handlers)
+	e := group.engine
+	e.buildMu.Lock()
+	defer e.buildMu.Unlock()
+	route.compile()
 
-	group.engine.router.AddRoute(method, fullPath, handlers)
+	e.routesMu.Lock()
+	defer e.routesMu.Unlock()
+	if err := route.router.Insert(method, route.Path, route); err != nil {
+		return route, routeError(route, err)
+	}
+	e.routes = append(e.routes, route)
+	e.growParams(route)
+	return route, nil
+}
 
-	return &Route{
-		Method: method,
-		Path:   fullPath,
-		engine: group.engine,
+// newRoute creates the route for handlers. All handlers but the last act
+// as route middleware; the route is stored in the router as *Route.
+func (group *RouterGroup) newRoute(method, path string, handlers []context.HandlerFunc) *Route {
+	if len(handlers) == 0 {
+		panic("kvolt: there must be at least one handler for '" + method + " " + path + "'")
+	}
+	route := &Route{
+		Method:   method,
+		Path:     group.prefix + path,
+		Source:   callerSource(),
+		engine:   group.engine,
+		router:   group.engine.router,
+		group:    group,
+		handlers: handlers,
+	}
+	if group.host != nil {
+		route.Host = group.host.pattern
+		route.router = group.host.router
+	}
+	return route
+}
+
+// RemoveRoute unregisters the group's route for method and path, given as
+// at registration (relative to the group, same param names). It reports
+// whether there was such a route. Safe to call while serving: in-flight
+// requests finish on the old route, new ones no longer see it. The removed
+// *Route is detached: Name, Desc and Use on it do nothing.
+func (group *RouterGroup) RemoveRoute(method, path string) bool {
+	e := group.engine
+	rt := e.router
+	if group.host != nil {
+		rt = group.host.router
+	}
+
+	e.routesMu.Lock()
+	defer e.routesMu.Unlock()
+	h := rt.Remove(method, group.prefix+path)
+	if h == nil {
+		return false
+	}
+	old := h.(*Route)
+	old.detached.Store(true)
+	e.routes = slices.DeleteFunc(e.routes, func(r *Route) bool { return r == old })
+	if old.name != "" {
+		delete(e.namedRoutes, old.name)
+	}
+	return true
+}
+
+// ReplaceRoute swaps the handlers of the group's route for method and path
+// in one step, so no request sees the route missing. The new route keeps
+// the old one's name and description but not its Route.Use middleware;
+// the old *Route is detached. Safe to call while serving.
+func (group *RouterGroup) ReplaceRoute(method, path string, handlers ...context.HandlerFunc) (*Route, error) {
+	route := group.newRoute(method, path, handlers)
+	e := group.engine
+	e.buildMu.Lock()
+	defer e.buildMu.Unlock()
+	route.compile()
+
+	e.routesMu.Lock()
+	defer e.routesMu.Unlock()
+	h := route.router.Replace(method, route.Path, route)
+	if h == nil {
+		return nil, errors.New("kvolt: no route registered for '" + method + " " + route.Path + "'")
+	}
+	old := h.(*Route)
+	old.detached.Store(true)
+	e.growParams(route)
+	if i := slices.Index(e.routes, old); i >= 0 {
+		e.routes[i] = route
+	}
+	if old.name != "" {
+		route.name = old.name
+		e.namedRoutes[old.name] = route
+	}
+	return route, nil
+}
+
+// growParams raises the engine's param capacity to fit route.
+// The caller holds routesMu.
+func (e *Engine) growParams(route *Route) {
+	n := route.router.MaxParams()
+	if route.group.host != nil {
+		n += route.group.host.params
+	}
+	if int64(n) > e.maxParams.Load() {
+		e.maxParams.Store(int64(n))
 	}
 }
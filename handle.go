@@ -0,0 +1,118 @@
+package kvolt
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// StatusCoder is implemented by typed responses that pick their own status
+// code (e.g. 201 Created). Handle uses 200 otherwise.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Handle adapts a typed function to a handler:
+//
+//	app.POST("/users/:org", kvolt.Handle(createUser))
+//
+//	func createUser(c *context.Context, req CreateUser) (User, error)
+//
+// The request is built from the body, decoded by its Content-Type like
+// c.Bind (see Context.DecodeBody), then fields tagged `uri:"..."`
+// (path params), `query:"..."` and `header:"..."`, and validated with the
+// "validate" tags. Malformed input is a 400, an unsupported Content-Type a
+// 415 and failed validation a 422 ValidationError.
+// The response is encoded by the engine renderer that best matches the
+// Accept header (JSON, XML or YAML unless more are registered with
+// Engine.RegisterRenderer; 406 if none is acceptable) unless the function
+// already wrote one.
+//
+// Register it with Typed to record Req and Resp on the route.
+func Handle[Req, Resp any](fn func(c *context.Context, req Req) (Resp, error)) context.HandlerFunc {
+	reqType := reflect.TypeFor[Req]()
+	return func(c *context.Context) error {
+		var req Req
+		target := interface{}(&req)
+		if reqType.Kind() == reflect.Ptr {
+			// Bind into a fresh value rather than through a nil pointer
+			v := reflect.New(reqType.Elem())
+			reflect.ValueOf(&req).Elem().Set(v)
+			target = v.Interface()
+		}
+		if err := bindRequest(c, target); err != nil {
+			return err
+		}
+
+		resp, err := fn(c, req)
+		if err != nil {
+			return err
+		}
+		if c.HeaderWritten() {
+			return nil
+		}
+		return encodeResponse(c, resp)
+	}
+}
+
+// Typed registers Handle(fn) with add, a route method such as app.POST or
+// group.GET, after any route middleware, and records Req and Resp on the
+// route (RouteInfo.Request/Response) so pkg/swagger can describe them:
+//
+//	kvolt.Typed(app.POST, "/users/:org", createUser)
+func Typed[Req, Resp any](add func(string, ...context.HandlerFunc) *Route, path string,
+	fn func(c *context.Context, req Req) (Resp, error), middleware ...context.HandlerFunc) *Route {
+	route := add(path, append(middleware[:len(middleware):len(middleware)], Handle(fn))...)
+	e := route.engine
+	e.routesMu.Lock()
+	route.typed = &typedHandler{request: reflect.TypeFor[Req](), response: reflect.TypeFor[Resp]()}
+	e.routesMu.Unlock()
+	return route
+}
+
+// typedHandler holds the types of a route registered with Typed.
+type typedHandler struct {
+	request, response reflect.Type
+}
+
+// bindRequest fills ptr from the body, path params, query and headers,
+// then validates it. Decoding errors are the *context.BindError that
+// c.Bind would return. The query only fills `query` tagged fields, so it
+// cannot override form fields decoded from the body.
+func bindRequest(c *context.Context, ptr interface{}) error {
+	if err := c.DecodeBody(ptr); err != nil {
+		return err
+	}
+	for _, b := range []context.Binder{context.BindingURI, context.BindingQueryTag, context.BindingHeader} {
+		if err := b.Bind(c, ptr); err != nil {
+			return &context.BindError{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	if reflect.TypeOf(ptr).Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	if err := c.Validate(ptr); err != nil {
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			return ve
+		}
+		return NewHTTPError(http.StatusUnprocessableEntity, err.Error()).WithInternal(err)
+	}
+	return nil
+}
+
+// encodeResponse writes resp in the format negotiated from the Accept header.
+func encodeResponse(c *context.Context, resp interface{}) error {
+	status := http.StatusOK
+	if sc, ok := resp.(StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+	if status == http.StatusNoContent {
+		c.Status(status)
+		return nil
+	}
+	return c.Negotiate(status, resp)
+}
@@ -0,0 +1,182 @@
+package kvolt
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/go-kvolt/kvolt/router"
+)
+
+// hostRouter holds the routes registered for one Engine.Host pattern.
+type hostRouter struct {
+	pattern string
+	labels  []string // pattern split on "."; ":name" labels capture
+	params  int      // number of ":name" labels
+	router  *router.Router
+}
+
+// Host returns a group whose routes only match requests for the given host.
+// The pattern is a hostname without port; labels starting with ':' match
+// any single label and are exposed through c.Param:
+//
+//	api := app.Host("api.example.com")
+//	tenant := app.Host(":tenant.example.com") // c.Param("tenant")
+//
+// Exact hostnames win over patterns, and patterns are tried in registration
+// order. Requests whose host matches no pattern, or whose path matches no
+// route of the host, are served by the routes registered on the engine.
+// Global middleware applies to host groups.
+func (e *Engine) Host(pattern string) *RouterGroup {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if pattern == "" {
+		panic("kvolt: host pattern must not be empty")
+	}
+
+	e.routesMu.Lock()
+	defer e.routesMu.Unlock()
+	hosts := e.hosts.Load()
+	var h *hostRouter
+	if hosts != nil {
+		h = hosts.static[pattern]
+		for _, ph := range hosts.params {
+			if ph.pattern == pattern {
+				h = ph
+			}
+		}
+	}
+	if h == nil {
+		h = &hostRouter{
+			pattern: pattern,
+			labels:  strings.Split(pattern, "."),
+			router:  router.New(),
+		}
+		for _, label := range h.labels {
+			if strings.HasPrefix(label, ":") {
+				h.params++
+			}
+		}
+		e.hosts.Store(hosts.with(h))
+	}
+
+	return &RouterGroup{
+		parent: e.RouterGroup,
+		host:   h,
+		engine: e,
+	}
+}
+
+// hostTable is the set of Host patterns. It is replaced, never changed, so
+// requests read it without locking.
+type hostTable struct {
+	static map[string]*hostRouter // exact hostnames
+	params []*hostRouter          // patterns with params, in registration order
+}
+
+// with returns a copy of t with h added; t may be nil.
+func (t *hostTable) with(h *hostRouter) *hostTable {
+	next := &hostTable{static: make(map[string]*hostRouter)}
+	if t != nil {
+		for k, v := range t.static {
+			next.static[k] = v
+		}
+		next.params = append(next.params, t.params...)
+	}
+	if strings.Contains(h.pattern, ":") {
+		next.params = append(next.params, h)
+	} else {
+		next.static[h.pattern] = h
+	}
+	return next
+}
+
+// matchHost returns the host router for a request Host header, appending
+// the params captured by its pattern to ps unless ps is nil. It returns nil
+// when nothing matches.
+func (e *Engine) matchHost(host string, ps *router.Params) *hostRouter {
+	hosts := e.hosts.Load()
+	if hosts == nil {
+		return nil
+	}
+	if strings.LastIndexByte(host, ':') > strings.LastIndexByte(host, ']') {
+		// has a port; checked first since SplitHostPort allocates its error
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if h, ok := hosts.static[host]; ok {
+		return h
+	}
+	for _, h := range hosts.params {
+		if h.match(host, ps) {
+			return h
+		}
+	}
+	return nil
+}
+
+// match compares the labels of host against the pattern in place, appending
+// captured labels to ps (if not nil) on success.
+func (h *hostRouter) match(host string, ps *router.Params) bool {
+	n := 0
+	if ps != nil {
+		n = len(*ps)
+	}
+	rest := host
+	for i, want := range h.labels {
+		label := rest
+		if i < len(h.labels)-1 {
+			dot := strings.IndexByte(rest, '.')
+			if dot < 0 {
+				return h.reset(ps, n)
+			}
+			label, rest = rest[:dot], rest[dot+1:]
+		} else if strings.IndexByte(rest, '.') >= 0 {
+			return h.reset(ps, n)
+		}
+		if !strings.HasPrefix(want, ":") {
+			if label != want {
+				return h.reset(ps, n)
+			}
+			continue
+		}
+		if label == "" {
+			return h.reset(ps, n)
+		}
+		if ps != nil {
+			*ps = append(*ps, router.Param{Key: want[1:], Value: label})
+		}
+	}
+	return true
+}
+
+// reset drops the params a failed match appended after the first n and
+// reports false.
+func (h *hostRouter) reset(ps *router.Params, n int) bool {
+	if ps != nil {
+		*ps = (*ps)[:n]
+	}
+	return false
+}
+
+// mergeAllow joins two Allow header values without duplicates.
+func mergeAllow(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	seen := make(map[string]bool)
+	var methods []string
+	for _, m := range strings.Split(a+", "+b, ", ") {
+		if !seen[m] {
+			seen[m] = true
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
@@ -1,14 +1,14 @@
 package kvolt
 
 import (
-	stdContext "context"
-	"fmt"
 	"html/template"
 	"net/http"
-	"os"
-	"os/signal"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kvolt/kvolt/context"
@@ -17,21 +17,106 @@ import (
 
 // Engine is the main framework instance.
 type Engine struct {
-	*RouterGroup  // Engine is the root group
-	router        *router.Router
+	*RouterGroup                 // Engine is the root group
+	router        *router.Router // fallback tree, used when no Host pattern matches
 	pool          sync.Pool
 	htmlTemplates *template.Template // Global templates
+	funcMap       template.FuncMap   // Custom template functions
+	renderers     *context.Renderers // Response formats for Negotiate and Handle
+
+	// routesMu guards routes, routeErrors and namedRoutes, and serializes
+	// route changes. Requests never take it: the trees and the host table
+	// are swapped atomically.
+	routesMu sync.RWMutex
+	// routes lists every registered route in registration order
+	routes []*Route
+	// routeErrors lists the routes that could not be registered, for Validate
+	routeErrors []*RouteError
+
+	// Host routing, see Engine.Host
+	hosts atomic.Pointer[hostTable]
+	// maxParams is the most params (host and path) a route captures, so
+	// pooled contexts can hold them without growing
+	maxParams atomic.Int64
+
+	// Named routes for reverse URL generation
+	namedRoutes map[string]*Route
+	urlFunc     func(name string, params ...interface{}) (string, error)
+
+	// HandleMethodNotAllowed answers with 405 and an Allow header when the path
+	// exists under another method. When false, such requests get a 404. Default: true.
+	HandleMethodNotAllowed bool
+
+	// HandleOPTIONS answers OPTIONS requests automatically with an Allow header
+	// when no OPTIONS route is registered for the path. Default: true.
+	HandleOPTIONS bool
+
+	// RedirectTrailingSlash redirects to the same path with the trailing slash
+	// added or removed when only that variant has a route. Default: true.
+	RedirectTrailingSlash bool
+
+	// RedirectFixedPath redirects to the canonical path when the request path
+	// matches a route only after cleaning (duplicate slashes, "." and "..")
+	// and a case-insensitive lookup. Default: false.
+	RedirectFixedPath bool
+
+	// UseRawPath routes on the escaped path (URL.RawPath), so an encoded
+	// slash ("%2F") stays inside a param instead of splitting it. Default: false.
+	UseRawPath bool
+
+	// UnescapePathValues unescapes param values when UseRawPath is set.
+	// Default: true.
+	UnescapePathValues bool
+
+	errorHandler ErrorHandler
+	noRoute      []context.HandlerFunc
+	noMethod     []context.HandlerFunc
+
+	// fallbacks holds the NoRoute, NoMethod and OPTIONS chains, compiled by Build
+	fallbacks atomic.Pointer[fallbackChains]
+
+	// gen counts middleware changes and builtGen is the gen compiled by
+	// Build; they differ while changes are not compiled yet. buildMu guards
+	// the middleware slices of groups and routes, noRoute and noMethod, and
+	// serializes compiling.
+	gen      atomic.Uint64
+	builtGen atomic.Uint64
+	buildMu  sync.Mutex
+
+	// closing is closed by Shutdown to end long-lived streams
+	closing chan struct{}
+
+	// Running servers, tracked for Shutdown
+	srvMu      sync.Mutex
+	servers    []*http.Server
+	shutdown   bool
+	started    bool // start hooks completed
+	drainDelay time.Duration
+
+	// Lifecycle
+	startHooks    []*Hook
+	shutdownHooks []*Hook
+	ready         atomic.Bool
 }
 
 // New creates a new kvolt Engine.
 func New() *Engine {
 	engine := &Engine{
-		router: router.New(),
+		router:                 router.New(),
+		HandleMethodNotAllowed: true,
+		HandleOPTIONS:          true,
+		RedirectTrailingSlash:  true,
+		UnescapePathValues:     true,
+		errorHandler:           DefaultErrorHandler,
+		renderers:              context.NewRenderers(),
+		closing:                make(chan struct{}),
+		namedRoutes:            make(map[string]*Route),
 	}
+	engine.urlFunc = engine.URL
 	engine.RouterGroup = &RouterGroup{
-		engine:     engine,
-		middleware: make([]context.HandlerFunc, 0),
+		engine: engine,
 	}
+	engine.invalidate() // fallbacks are compiled on the first Build
 	// Initialize Sync.Pool
 	engine.pool.New = func() interface{} {
 		return context.New(nil, nil)
@@ -45,28 +130,40 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	c := e.pool.Get().(*context.Context)
 	c.Reset(w, r)
 	c.Templates = e.htmlTemplates // Inject templates
+	c.ErrorHandler = e.errorHandler
+	c.Renderers = e.renderers
+	c.Closing = e.closing
+	c.URLBuilder = e.urlFunc
+
+	if e.builtGen.Load() != e.gen.Load() {
+		e.Build()
+	}
 
 	// Route matching
-	val, params, found := e.router.Find(r.Method, r.URL.Path)
-	if found {
-		if handlers, ok := val.([]context.HandlerFunc); ok {
-			c.Handlers = handlers
-			c.Params = params
+	path := r.URL.Path
+	if e.UseRawPath && r.URL.RawPath != "" {
+		path = r.URL.RawPath
+	}
+	if n := int(e.maxParams.Load()); cap(c.Params) < n {
+		c.Params = make(router.Params, 0, n)
+	}
+	if route := e.lookup(r, path, &c.Params); route != nil {
+		c.Handlers = route.handlerChain()
+		if e.UseRawPath && e.UnescapePathValues && path != r.URL.Path {
+			unescapeParams(c.Params)
+		}
+	} else if e.redirect(w, r, path) {
+		e.pool.Put(c)
+		return
+	} else if allow := e.allowed(r, path); allow != "" {
+		c.Writer.Header().Set("Allow", allow)
+		if r.Method == http.MethodOptions && e.HandleOPTIONS {
+			c.Handlers = e.fallbacks.Load().options
 		} else {
-			// This path should ideally not be reached if AddRoute type checks or strict typing is used
-			// But for now keeping compatible with current structure where handle is interface{}
-			// If handle is NOT []HandlerFunc (e.g. single handler), we might need to wrap it?
-			// The current AddRoute in router.go takes `Handler any`.
-			// In kvolt.go, we seem to treat it as []context.HandlerFunc?
-			// Let's check AddRoute usage in RouterGroup (not visible here but inferred).
-			// If matching logic passes, we assume it's correct type.
-			c.Handlers = []context.HandlerFunc{}
+			c.Handlers = e.fallbacks.Load().noMethod
 		}
 	} else {
-		// 404 Handler - Append to global middleware
-		c.Handlers = append(e.RouterGroup.middleware, func(c *context.Context) error {
-			return c.Status(404).String(404, "Not Found")
-		})
+		c.Handlers = e.fallbacks.Load().noRoute
 	}
 
 	// Start the chain
@@ -76,115 +173,279 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	e.pool.Put(c)
 }
 
-// Default server timeouts for production (slowloris protection and connection hygiene).
-const (
-	DefaultReadHeaderTimeout = 10 * time.Second
-	DefaultReadTimeout       = 30 * time.Second
-	DefaultWriteTimeout      = 30 * time.Second
-	DefaultIdleTimeout       = 120 * time.Second
-)
+// lookup finds the route for path in the tree of the matching Host pattern,
+// then in the fallback tree. Host params, then path params, are appended
+// to ps; on a miss ps is left empty.
+func (e *Engine) lookup(r *http.Request, path string, ps *router.Params) *Route {
+	if h := e.matchHost(r.Host, ps); h != nil {
+		if route := findRoute(h.router, r.Method, path, ps); route != nil {
+			return route
+		}
+		*ps = (*ps)[:0]
+	}
+	return findRoute(e.router, r.Method, path, ps)
+}
 
-// Run starts the HTTP server with Graceful Shutdown and production timeouts.
-func (e *Engine) Run(addr string) error {
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           e,
-		ReadHeaderTimeout: DefaultReadHeaderTimeout,
-		ReadTimeout:       DefaultReadTimeout,
-		WriteTimeout:      DefaultWriteTimeout,
-		IdleTimeout:       DefaultIdleTimeout,
+func findRoute(rt *router.Router, method, path string, ps *router.Params) *Route {
+	val, _ := rt.Match(method, path, ps)
+	if val == nil && method == http.MethodHead {
+		// Answer HEAD from the GET route; net/http discards the body
+		val, _ = rt.Match(http.MethodGet, path, ps)
+	}
+	if val == nil {
+		return nil
 	}
+	return val.(*Route)
+}
 
-	fmt.Println("⚡ KVolt is running on http://localhost" + addr)
-	fmt.Println("Press Ctrl+C to stop")
+// routers returns the trees that may serve r: the matching host's, then the fallback.
+func (e *Engine) routers(r *http.Request) []*router.Router {
+	if h := e.matchHost(r.Host, nil); h != nil {
+		return []*router.Router{h.router, e.router}
+	}
+	return []*router.Router{e.router}
+}
+
+// redirect answers r with a redirect to the canonical path when
+// RedirectTrailingSlash or RedirectFixedPath applies. It reports whether
+// a response was written.
+func (e *Engine) redirect(w http.ResponseWriter, r *http.Request, path string) bool {
+	if r.Method == http.MethodConnect || path == "/" || !e.RedirectTrailingSlash && !e.RedirectFixedPath {
+		return false
+	}
+	methods := []string{r.Method}
+	if r.Method == http.MethodHead {
+		methods = append(methods, http.MethodGet)
+	}
 
-	// Non-blocking start
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Listen: %s\n", err)
+	for _, rt := range e.routers(r) {
+		for _, method := range methods {
+			if e.RedirectTrailingSlash {
+				if _, _, tsr := rt.Lookup(method, path); tsr {
+					fixed := path + "/"
+					if path[len(path)-1] == '/' {
+						fixed = path[:len(path)-1]
+					}
+					redirectTo(w, r, fixed, e.UseRawPath)
+					return true
+				}
+			}
+			if e.RedirectFixedPath {
+				if fixed, ok := rt.FixedPath(method, router.CleanPath(path), e.RedirectTrailingSlash); ok {
+					redirectTo(w, r, fixed, e.UseRawPath)
+					return true
+				}
+			}
 		}
-	}()
+	}
+	return false
+}
+
+// redirectTo sends a permanent redirect to path, keeping the query string:
+// 301 for GET and HEAD, 308 otherwise so the method and body are kept.
+func redirectTo(w http.ResponseWriter, r *http.Request, path string, escaped bool) {
+	// Never emit "//host"-style locations, which browsers treat as absolute
+	path = "/" + strings.TrimLeft(path, "/")
+	location := path
+	if !escaped {
+		location = (&url.URL{Path: path}).EscapedPath()
+	}
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
 
-	// Wait for signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	fmt.Println("\nShutting down server...")
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(w, r, location, code)
+}
 
-	// Context with timeout
-	ctx, cancel := stdContext.WithTimeout(stdContext.Background(), 5*time.Second)
-	defer cancel()
+// unescapeParams decodes percent-escapes in param values routed on RawPath.
+func unescapeParams(params router.Params) {
+	for i := range params {
+		if strings.IndexByte(params[i].Value, '%') < 0 {
+			continue
+		}
+		if v, err := url.PathUnescape(params[i].Value); err == nil {
+			params[i].Value = v
+		}
+	}
+}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Println("Server Shutdown Error:", err)
-		return err
+// allowed returns the Allow header value when the request should be answered
+// with an automatic OPTIONS or 405 response, or "" when it is a plain 404.
+func (e *Engine) allowed(r *http.Request, path string) string {
+	if r.Method == http.MethodOptions && e.HandleOPTIONS || e.HandleMethodNotAllowed {
+		allow := ""
+		for _, rt := range e.routers(r) {
+			allow = mergeAllow(allow, rt.Allowed(path))
+		}
+		return allow
 	}
+	return ""
+}
 
-	fmt.Println("Server exiting")
-	return nil
+// Use adds global middleware to the engine.
+// Global middleware also runs for NoRoute, NoMethod and automatic OPTIONS replies.
+func (e *Engine) Use(h ...context.HandlerFunc) {
+	e.RouterGroup.Use(h...)
 }
 
-// LoadHTMLGlob loads HTML templates from a directory pattern.
-func (e *Engine) LoadHTMLGlob(pattern string) {
-	e.htmlTemplates = template.Must(template.ParseGlob(pattern))
+// NoRoute sets the handlers called when no route matches the request path.
+// The default returns ErrNotFound, which is rendered by the error handler.
+func (e *Engine) NoRoute(handlers ...context.HandlerFunc) {
+	e.buildMu.Lock()
+	e.noRoute = handlers
+	e.buildMu.Unlock()
+	e.invalidate()
 }
 
-// RunTLS starts the HTTPS server (enabling HTTP/2 by default) with production timeouts.
-func (e *Engine) RunTLS(addr, certFile, keyFile string) error {
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           e,
-		ReadHeaderTimeout: DefaultReadHeaderTimeout,
-		ReadTimeout:       DefaultReadTimeout,
-		WriteTimeout:      DefaultWriteTimeout,
-		IdleTimeout:       DefaultIdleTimeout,
+// NoMethod sets the handlers called when the path matches under another method.
+// The Allow header is already set when they run.
+// The default returns ErrMethodNotAllowed, which is rendered by the error handler.
+func (e *Engine) NoMethod(handlers ...context.HandlerFunc) {
+	e.buildMu.Lock()
+	e.noMethod = handlers
+	e.buildMu.Unlock()
+	e.invalidate()
+}
+
+// SetErrorHandler sets the function that renders every error returned by a handler,
+// including the NoRoute and NoMethod defaults. Passing nil restores DefaultErrorHandler.
+func (e *Engine) SetErrorHandler(h ErrorHandler) {
+	if h == nil {
+		h = DefaultErrorHandler
 	}
+	e.errorHandler = h
+}
 
-	fmt.Println("⚡ KVolt (HTTPS) is running on https://localhost" + addr)
-	fmt.Println("Press Ctrl+C to stop")
+// RegisterRenderer makes c.Negotiate and Handle offer r for mediaType,
+// after the ones already registered (JSON, XML and YAML by default).
+// Registering a media type again replaces its renderer:
+//
+//	app.RegisterRenderer("application/msgpack", msgpackRenderer{})
+func (e *Engine) RegisterRenderer(mediaType string, r context.Renderer) {
+	e.renderers.Register(mediaType, r)
+}
 
-	// Non-blocking start
-	go func() {
-		if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Listen: %s\n", err)
-		}
-	}()
+// Build compiles the handler chain of every route and of the NoRoute/NoMethod
+// fallbacks from the current middleware. Server calls it on start and
+// ServeHTTP on the first request, so calling it directly is only needed to
+// front-load the work. A later Use triggers a rebuild on the next request;
+// routes added later are compiled when they are registered. Chains are
+// swapped atomically, so Use is safe while serving: requests already
+// running keep the chain they started with.
+func (e *Engine) Build() {
+	e.buildMu.Lock()
+	defer e.buildMu.Unlock()
+	gen := e.gen.Load()
+	if e.builtGen.Load() == gen {
+		return
+	}
+	e.routesMu.RLock()
+	for _, r := range e.routes {
+		r.compile()
+	}
+	e.routesMu.RUnlock()
+	e.buildFallbacks()
+	// A change made while compiling bumped gen, so the next request rebuilds
+	e.builtGen.Store(gen)
+}
 
-	// Wait for signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	fmt.Println("\nShutting down server...")
+// invalidate marks compiled chains as stale.
+func (e *Engine) invalidate() {
+	e.gen.Add(1)
+}
 
-	// Context with timeout
-	ctx, cancel := stdContext.WithTimeout(stdContext.Background(), 5*time.Second)
-	defer cancel()
+// fallbackChains are the chains run when no route handles a request.
+type fallbackChains struct {
+	noRoute  []context.HandlerFunc
+	noMethod []context.HandlerFunc
+	options  []context.HandlerFunc
+}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Println("Server Shutdown Error:", err)
-		return err
+// buildFallbacks compiles the fallback chains. The caller holds buildMu.
+func (e *Engine) buildFallbacks() {
+	noRoute := e.noRoute
+	if len(noRoute) == 0 {
+		noRoute = []context.HandlerFunc{func(c *context.Context) error { return ErrNotFound }}
 	}
+	noMethod := e.noMethod
+	if len(noMethod) == 0 {
+		noMethod = []context.HandlerFunc{func(c *context.Context) error { return ErrMethodNotAllowed }}
+	}
+	e.fallbacks.Store(&fallbackChains{
+		noRoute:  e.combineHandlers(noRoute...),
+		noMethod: e.combineHandlers(noMethod...),
+		options: e.combineHandlers(func(c *context.Context) error {
+			return c.Status(http.StatusNoContent).String(http.StatusNoContent, "")
+		}),
+	})
+}
 
-	fmt.Println("Server exiting")
-	return nil
+// combineHandlers returns a fresh chain of the global middleware followed by handlers.
+func (e *Engine) combineHandlers(handlers ...context.HandlerFunc) []context.HandlerFunc {
+	merged := make([]context.HandlerFunc, 0, len(e.RouterGroup.middleware)+len(handlers))
+	merged = append(merged, e.RouterGroup.middleware...)
+	return append(merged, handlers...)
+}
+
+// LoadHTMLGlob loads HTML templates from a directory pattern.
+func (e *Engine) LoadHTMLGlob(pattern string) {
+	e.htmlTemplates = template.Must(template.New("").Funcs(e.FuncMap()).ParseGlob(pattern))
 }
 
 // RouteInfo represents a route metadata.
 type RouteInfo struct {
 	Method  string
 	Path    string
+	Host    string // Engine.Host pattern, "" for the fallback tree
+	Name    string
 	Summary string
+	// Source is the file:line where the route was registered.
+	Source string
+	// Handler is the function name of the final handler.
+	Handler string
+	// Middleware lists the function names of everything that runs before
+	// Handler: group middleware, route middleware, then extra handlers.
+	Middleware []string
+	// Request and Response are the Req/Resp types of a route registered
+	// with Typed; nil otherwise.
+	Request, Response reflect.Type
 }
 
-// Routes returns a list of registered routes.
+// Routes returns a list of registered routes in registration order.
 func (e *Engine) Routes() []RouteInfo {
-	var routes []RouteInfo
-	e.router.Walk(func(method, path, desc string) {
-		routes = append(routes, RouteInfo{
-			Method:  method,
-			Path:    path,
-			Summary: desc,
-		})
-	})
+	e.Build()
+	e.routesMu.RLock()
+	defer e.routesMu.RUnlock()
+	routes := make([]RouteInfo, 0, len(e.routes))
+	for _, r := range e.routes {
+		chain := r.handlerChain()
+		middleware := make([]string, 0, len(chain)-1)
+		for _, h := range chain[:len(chain)-1] {
+			middleware = append(middleware, nameOfFunction(h))
+		}
+		info := RouteInfo{
+			Method:     r.Method,
+			Path:       r.Path,
+			Host:       r.Host,
+			Name:       r.name,
+			Summary:    r.router.Documentation(r.Method, r.Path),
+			Source:     r.Source,
+			Handler:    nameOfFunction(chain[len(chain)-1]),
+			Middleware: middleware,
+		}
+		if r.typed != nil {
+			info.Request, info.Response = r.typed.request, r.typed.response
+		}
+		routes = append(routes, info)
+	}
 	return routes
 }
+
+// nameOfFunction returns the fully qualified name of a function value.
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
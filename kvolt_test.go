@@ -1,8 +1,21 @@
 package kvolt
 
 import (
+	stdContext "context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-kvolt/kvolt/context"
 )
@@ -54,3 +67,1480 @@ func TestEngine_Routes(t *testing.T) {
 		t.Errorf("Routes: want at least 2, got %d", len(routes))
 	}
 }
+
+func TestEngine_MethodNotAllowed(t *testing.T) {
+	app := New()
+	app.GET("/items", func(c *context.Context) error { return c.String(200, "list") })
+	app.POST("/items", func(c *context.Context) error { return c.String(201, "created") })
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("DELETE", "/items", nil)
+	app.ServeHTTP(w, r)
+	if w.Code != 405 {
+		t.Errorf("405: want 405, got %d", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("405: Allow want %q, got %q", "GET, HEAD, OPTIONS, POST", got)
+	}
+
+	app.HandleMethodNotAllowed = false
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("DELETE", "/items", nil))
+	if w.Code != 404 {
+		t.Errorf("405 disabled: want 404, got %d", w.Code)
+	}
+}
+
+func TestEngine_HEADFromGET(t *testing.T) {
+	app := New()
+	app.GET("/ok", func(c *context.Context) error {
+		c.Writer.Header().Set("X-Route", "get")
+		return c.String(200, "OK")
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("HEAD", "/ok", nil))
+	if w.Code != 200 || w.Header().Get("X-Route") != "get" {
+		t.Errorf("HEAD: want 200 from GET route, got %d %q", w.Code, w.Header().Get("X-Route"))
+	}
+}
+
+func TestEngine_AutoOPTIONS(t *testing.T) {
+	app := New()
+	app.PATCH("/users/:id", func(c *context.Context) error { return nil })
+	app.Any("/any", func(c *context.Context) error { return c.String(200, c.Request.Method) })
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if w.Code != 204 {
+		t.Errorf("OPTIONS: want 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "OPTIONS, PATCH" {
+		t.Errorf("OPTIONS: Allow want %q, got %q", "OPTIONS, PATCH", got)
+	}
+
+	// Explicit OPTIONS route (registered by Any) wins over the automatic reply
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/any", nil))
+	if w.Code != 200 || w.Body.String() != "OPTIONS" {
+		t.Errorf("OPTIONS explicit: want 200 OPTIONS, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEngine_HTTPError(t *testing.T) {
+	app := New()
+	app.GET("/missing", func(c *context.Context) error {
+		return NewHTTPError(404, "user not found").WithCode("user_not_found").WithInternal(errors.New("sql: no rows"))
+	})
+	app.GET("/boom", func(c *context.Context) error {
+		return errors.New("db down")
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != 404 {
+		t.Errorf("HTTPError: want 404, got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "user not found") || !strings.Contains(body, "user_not_found") || strings.Contains(body, "sql") {
+		t.Errorf("HTTPError: unexpected body %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/boom", nil))
+	if w.Code != 500 || strings.Contains(w.Body.String(), "db down") {
+		t.Errorf("plain error: want 500 without internals, got %d %s", w.Code, w.Body.String())
+	}
+
+	app.GET("/page", func(c *context.Context) error {
+		page, err := c.QueryInt("n")
+		if err != nil {
+			return err
+		}
+		return c.String(200, "%d", page)
+	})
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/page?n=two", nil))
+	if w.Code != 400 || !strings.Contains(w.Body.String(), `query parameter \"n\": \"two\" is not a valid int`) {
+		t.Errorf("ParamError: want 400 with message, got %d %s", w.Code, w.Body.String())
+	}
+
+	var seen []error
+	app.Use(func(c *context.Context) error {
+		c.Next()
+		seen = c.Errors
+		return nil
+	})
+	app.GET("/locked", func(c *context.Context) error {
+		return c.AbortWithError(http.StatusConflict, errors.New("row 7 is locked"))
+	})
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/locked", nil))
+	if w.Code != 409 || !strings.Contains(w.Body.String(), `"error":"Conflict"`) || len(seen) != 1 {
+		t.Errorf("AbortWithError: want 409 Conflict without the cause, seen by middleware, got %d %s %v", w.Code, w.Body.String(), seen)
+	}
+}
+
+func TestEngine_SetErrorHandler(t *testing.T) {
+	app := New()
+	app.SetErrorHandler(ProblemErrorHandler)
+	app.GET("/x", func(c *context.Context) error { return nil })
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/nope", nil))
+	if w.Code != 404 {
+		t.Errorf("problem 404: want 404, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("problem 404: Content-Type want application/problem+json, got %s", ct)
+	}
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("POST", "/x", nil))
+	if w.Code != 405 || !strings.Contains(w.Body.String(), `"status":405`) {
+		t.Errorf("problem 405: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEngine_NoRoute(t *testing.T) {
+	app := New()
+	app.Use(func(c *context.Context) error {
+		c.Writer.Header().Set("X-Global", "1")
+		c.Next()
+		return nil
+	})
+	app.NoRoute(func(c *context.Context) error {
+		return c.String(404, "custom not found")
+	})
+	app.NoMethod(func(c *context.Context) error {
+		return c.String(405, "custom no method")
+	})
+	app.GET("/x", func(c *context.Context) error { return nil })
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/nope", nil))
+		if w.Code != 404 || w.Body.String() != "custom not found" || w.Header().Get("X-Global") != "1" {
+			t.Errorf("NoRoute: got %d %q", w.Code, w.Body.String())
+		}
+	}
+	if len(app.RouterGroup.middleware) != 1 {
+		t.Errorf("NoRoute: global middleware grew to %d", len(app.RouterGroup.middleware))
+	}
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("PUT", "/x", nil))
+	if w.Code != 405 || w.Body.String() != "custom no method" || w.Header().Get("Allow") == "" {
+		t.Errorf("NoMethod: got %d %q Allow=%q", w.Code, w.Body.String(), w.Header().Get("Allow"))
+	}
+}
+
+func TestEngine_ServerShutdown(t *testing.T) {
+	app := New()
+	app.GET("/ping", func(c *context.Context) error { return c.String(200, "pong") })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Server(ServerConfig{
+			Listener:       ln,
+			DisableSignals: true,
+			Logger:         log.New(io.Discard, "", 0),
+		})
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/ping")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pong" {
+		t.Errorf("GET: want pong, got %s", body)
+	}
+
+	ctx, cancel := stdContext.WithTimeout(stdContext.Background(), time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Server: want nil after Shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not return after Shutdown")
+	}
+}
+
+func TestEngine_ShutdownEndsStreams(t *testing.T) {
+	app := New()
+	app.GET("/events", func(c *context.Context) error {
+		events := make(chan context.Event, 1)
+		events <- context.Event{ID: "1", Data: "hello"}
+		return c.StreamEvents(events, context.StreamConfig{})
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Server(ServerConfig{
+			Listener:       ln,
+			WriteTimeout:   50 * time.Millisecond, // lifted for streams
+			DisableSignals: true,
+			Logger:         log.New(io.Discard, "", 0),
+		})
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/events")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, len("id: 1\ndata: hello\n\n"))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "id: 1\ndata: hello\n\n" {
+		t.Fatalf("first event: got %q %v", buf, err)
+	}
+	time.Sleep(100 * time.Millisecond) // past WriteTimeout
+
+	ctx, cancel := stdContext.WithTimeout(stdContext.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Shutdown: stream held the drain for %v", d)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("stream: want a clean end, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Server: %v", err)
+	}
+}
+
+func TestEngine_ServerAdminAndUnix(t *testing.T) {
+	app := New()
+	app.GET("/ping", func(c *context.Context) error { return c.String(200, "pong") })
+
+	sock := filepath.Join(t.TempDir(), "kvolt.sock")
+	unixLn, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	admin := http.NewServeMux()
+	admin.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+
+	// Reserve a free admin port
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminAddr := adminLn.Addr().String()
+	adminLn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Server(ServerConfig{
+			Listener:       unixLn,
+			AdminAddr:      adminAddr,
+			AdminHandler:   admin,
+			DisableSignals: true,
+			Logger:         log.New(io.Discard, "", 0),
+		})
+	}()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx stdContext.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := unixClient.Get("http://unix/ping")
+	if err != nil {
+		t.Fatalf("unix GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("unix GET: want 200, got %d", resp.StatusCode)
+	}
+
+	var adminResp *http.Response
+	for i := 0; i < 50; i++ {
+		if adminResp, err = http.Get("http://" + adminAddr + "/healthz"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("admin GET: %v", err)
+	}
+	adminResp.Body.Close()
+	if adminResp.StatusCode != 200 {
+		t.Errorf("admin GET: want 200, got %d", adminResp.StatusCode)
+	}
+
+	if err := app.Shutdown(stdContext.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	<-done
+}
+
+func TestEngine_ServerNoAddr(t *testing.T) {
+	if err := New().Server(ServerConfig{DisableSignals: true}); err == nil {
+		t.Error("Server without address: want error")
+	}
+}
+
+func TestEngine_ServerInvalidRoutesClosesListener(t *testing.T) {
+	app := New()
+	app.GET("/files/:a<", func(c *context.Context) error { return nil })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Server(ServerConfig{Listener: ln, DisableSignals: true}); err == nil {
+		t.Fatal("Server with invalid routes: want error")
+	}
+	if _, err := ln.Accept(); err == nil {
+		t.Error("Server with invalid routes: want the listener closed")
+	}
+}
+
+func TestEngine_RunUnix(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "not-a-socket")
+	if err := os.WriteFile(file, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := New().RunUnix(file); err == nil {
+		t.Error("RunUnix on a regular file: want error")
+	}
+	if b, err := os.ReadFile(file); err != nil || string(b) != "keep" {
+		t.Errorf("RunUnix on a regular file: file was touched (%q, %v)", b, err)
+	}
+
+	sock := filepath.Join(dir, "kvolt.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	app := New()
+	done := make(chan error, 1)
+	go func() { done <- app.RunUnix(sock) }()
+	for i := 0; !app.Ready() && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !app.Ready() {
+		t.Fatalf("RunUnix over a stale socket did not start: %v", <-done)
+	}
+	if err := app.Shutdown(stdContext.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunUnix: %v", err)
+	}
+	if _, err := os.Lstat(sock); !os.IsNotExist(err) {
+		t.Errorf("RunUnix: want the socket file removed after shutdown, got %v", err)
+	}
+}
+
+type recordingService struct {
+	name string
+	mu   *sync.Mutex
+	log  *[]string
+}
+
+func (s recordingService) Start() { s.record("start " + s.name) }
+func (s recordingService) Stop()  { s.record("stop " + s.name) }
+func (s recordingService) record(ev string) {
+	s.mu.Lock()
+	*s.log = append(*s.log, ev)
+	s.mu.Unlock()
+}
+
+func TestEngine_LifecycleHooks(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	app := New()
+	app.GET("/readyz", app.ReadinessHandler())
+	app.Manage("queue", recordingService{"queue", &mu, &events})
+	app.Manage("scheduler", recordingService{"scheduler", &mu, &events})
+	app.OnShutdown(func(ctx stdContext.Context) error {
+		<-ctx.Done() // never finishes on its own
+		return nil
+	}).Name("slow").Timeout(20 * time.Millisecond).Order(-1)
+
+	if app.Ready() {
+		t.Error("Ready before start: want false")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Server(ServerConfig{
+			Listener:       ln,
+			DisableSignals: true,
+			DrainDelay:     50 * time.Millisecond,
+			Logger:         log.New(io.Discard, "", 0),
+		})
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("readyz while serving: want 200, got %d", resp.StatusCode)
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- app.Shutdown(stdContext.Background()) }()
+
+	// During the drain delay the listener still accepts requests but reports not ready
+	time.Sleep(10 * time.Millisecond)
+	resp, err = http.Get("http://" + ln.Addr().String() + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz during drain: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("readyz during drain: want 503, got %d", resp.StatusCode)
+	}
+
+	err = <-shutdownErr
+	if err == nil || !strings.Contains(err.Error(), "hook slow") {
+		t.Errorf("Shutdown: want timeout error from slow hook, got %v", err)
+	}
+	<-done
+
+	want := "start queue,start scheduler,stop scheduler,stop queue"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("hook order: want %q, got %q", want, got)
+	}
+}
+
+func TestEngine_StartHookFailure(t *testing.T) {
+	app := New()
+	stopped := false
+	app.OnStart(func(stdContext.Context) error { return errors.New("db unreachable") })
+	app.OnShutdown(func(stdContext.Context) error { stopped = true; return nil })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Server(ServerConfig{Listener: ln, DisableSignals: true, Logger: log.New(io.Discard, "", 0)})
+	if err == nil || !strings.Contains(err.Error(), "db unreachable") {
+		t.Errorf("Server: want start hook error, got %v", err)
+	}
+	if !stopped {
+		t.Error("Server: shutdown hooks should run after a failed start")
+	}
+
+	// Only the services started before the failing hook are stopped
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	app = New()
+	app.Manage("queue", recordingService{"queue", &mu, &events})
+	app.OnStart(func(stdContext.Context) error { return errors.New("db unreachable") })
+	app.Manage("scheduler", recordingService{"scheduler", &mu, &events})
+
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Server(ServerConfig{Listener: ln, DisableSignals: true, Logger: log.New(io.Discard, "", 0)}); err == nil {
+		t.Error("Server: want start hook error")
+	}
+	if got := strings.Join(events, ","); got != "start queue,stop queue" {
+		t.Errorf("failed start: want only the queue started and stopped, got %q", got)
+	}
+}
+
+func TestEngine_ShutdownDuringStartHooks(t *testing.T) {
+	app := New()
+	stopped := false
+	app.OnStart(func(ctx stdContext.Context) error {
+		return app.Shutdown(ctx) // e.g. a signal handler firing during startup
+	})
+	app.OnShutdown(func(stdContext.Context) error { stopped = true; return nil })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Server(ServerConfig{Listener: ln, DisableSignals: true, Logger: log.New(io.Discard, "", 0)})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("Server: want http.ErrServerClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server kept serving after Shutdown during start hooks")
+	}
+	if !stopped {
+		t.Error("Server: shutdown hooks should run for what started")
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("Server: listener should be closed")
+	}
+}
+
+func TestWrapHAndWrapF(t *testing.T) {
+	app := New()
+	app.GET("/h", WrapH(http.NotFoundHandler()))
+	app.GET("/f", WrapF(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("std"))
+	}))
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/h", nil))
+	if w.Code != 404 {
+		t.Errorf("WrapH: want 404, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/f", nil))
+	if w.Body.String() != "std" {
+		t.Errorf("WrapF: want std, got %q", w.Body.String())
+	}
+}
+
+func TestRouterGroup_Mount(t *testing.T) {
+	sub := New()
+	sub.GET("/", func(c *context.Context) error { return c.String(200, "sub root") })
+	sub.GET("/users/:id", func(c *context.Context) error { return c.String(200, "user "+c.Param("id")) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Path)) })
+
+	app := New()
+	app.Group("/api").Mount("/v2", sub)
+	app.Mount("/std", mux)
+
+	cases := []struct{ method, path, body string }{
+		{"GET", "/api/v2/users/7", "user 7"},
+		{"GET", "/api/v2", "sub root"},
+		{"GET", "/api/v2/", "sub root"},
+		{"GET", "/std/debug/vars", "/debug/vars"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != 200 || w.Body.String() != tc.body {
+			t.Errorf("Mount %s %s: want 200 %q, got %d %q", tc.method, tc.path, tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	// Three routes per method and mount, without CONNECT or TRACE
+	if got := len(app.Routes()); got != 2*3*len(mountMethods) {
+		t.Errorf("Mount: want %d routes, got %d", 2*3*len(mountMethods), got)
+	}
+	for _, method := range []string{"CONNECT", "TRACE"} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(method, "/std/debug/vars", nil))
+		if w.Code != 405 {
+			t.Errorf("Mount %s: want 405, got %d", method, w.Code)
+		}
+	}
+
+	// The mounted engine answers 405 itself
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("POST", "/api/v2/users/7", nil))
+	if w.Code != 405 {
+		t.Errorf("Mount POST: want 405 from sub-engine, got %d", w.Code)
+	}
+}
+
+func TestRouterGroup_MountLookAlikePaths(t *testing.T) {
+	app := New()
+	app.Mount("/admin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("mounted")) }))
+	app.GET("/administrators", func(c *context.Context) error { return c.String(200, "list") })
+	app.NoRoute(func(c *context.Context) error { return c.String(404, "custom") })
+
+	cases := []struct {
+		method, path string
+		code         int
+		body, header string
+	}{
+		{"GET", "/admin/users", 200, "mounted", ""},
+		{"GET", "/admin/", 200, "mounted", ""},
+		{"GET", "/administrator", 404, "custom", ""},
+		{"GET", "/administrators/", 301, "", "/administrators"},
+		{"POST", "/administrators", 405, "", "GET, HEAD, OPTIONS"},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s %s: want %d %q, got %d %q", tc.method, tc.path, tc.code, tc.body, w.Code, w.Body.String())
+		}
+		switch tc.code {
+		case 301:
+			if got := w.Header().Get("Location"); got != tc.header {
+				t.Errorf("%s %s: want Location %s, got %q", tc.method, tc.path, tc.header, got)
+			}
+		case 405:
+			if got := w.Header().Get("Allow"); got != tc.header {
+				t.Errorf("%s %s: want Allow %q, got %q", tc.method, tc.path, tc.header, got)
+			}
+		}
+	}
+}
+
+func TestEngine_URL(t *testing.T) {
+	app := New()
+	noop := func(c *context.Context) error { return nil }
+	app.GET("/users/:id", noop).Name("user.show")
+	app.Group("/v1").GET("/orgs/:org/files/*path", noop).Name("org.file")
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"user.show", []interface{}{42}, "/users/42"},
+		{"user.show", []interface{}{"a b/c"}, "/users/a%20b%2Fc"},
+		{"org.file", []interface{}{"acme", "docs/read me.md"}, "/v1/orgs/acme/files/docs/read%20me.md"},
+	}
+	for _, tc := range cases {
+		got, err := app.URL(tc.name, tc.params...)
+		if err != nil || got != tc.want {
+			t.Errorf("URL(%s, %v): want %q, got %q (err: %v)", tc.name, tc.params, tc.want, got, err)
+		}
+	}
+
+	if _, err := app.URL("user.show"); err == nil {
+		t.Error("URL with missing param: want error")
+	}
+	if _, err := app.URL("user.show", 1, 2); err == nil {
+		t.Error("URL with extra param: want error")
+	}
+	if _, err := app.URL("nope"); err == nil {
+		t.Error("URL unknown name: want error")
+	}
+
+	var named bool
+	for _, r := range app.Routes() {
+		if r.Path == "/users/:id" && r.Name == "user.show" {
+			named = true
+		}
+	}
+	if !named {
+		t.Error("Routes: want Name on named route")
+	}
+}
+
+func TestContext_URLForAndTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tpl := `<a href="{{ url "user.show" .ID }}">profile</a>`
+	if err := os.WriteFile(filepath.Join(dir, "link.html"), []byte(tpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := New()
+	app.LoadHTMLGlob(filepath.Join(dir, "*.html"))
+	app.GET("/users/:id", func(c *context.Context) error { return nil }).Name("user.show")
+	app.GET("/me", func(c *context.Context) error {
+		u, err := c.URLFor("user.show", 7)
+		if err != nil {
+			return err
+		}
+		return c.Redirect(302, u)
+	})
+	app.GET("/link", func(c *context.Context) error {
+		return c.RenderHTML(200, "link.html", map[string]int{"ID": 9})
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != 302 || w.Header().Get("Location") != "/users/7" {
+		t.Errorf("URLFor redirect: want 302 /users/7, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/link", nil))
+	if !strings.Contains(w.Body.String(), `href="/users/9"`) {
+		t.Errorf("url template func: got %q", w.Body.String())
+	}
+}
+
+func routeTag(tag string) context.HandlerFunc {
+	return func(c *context.Context) error {
+		c.Writer.Header().Add("X-Chain", tag)
+		c.Next()
+		return nil
+	}
+}
+
+func listUsers(c *context.Context) error { return c.String(200, "users") }
+
+func TestRoute_PerRouteMiddleware(t *testing.T) {
+	app := New()
+	app.Use(routeTag("global"))
+	app.GET("/users", routeTag("inline"), listUsers).Use(routeTag("route"))
+	app.GET("/open", listUsers)
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if got := strings.Join(w.Header().Values("X-Chain"), ","); got != "global,route,inline" || w.Body.String() != "users" {
+		t.Errorf("chain: want global,route,inline users, got %q %q", got, w.Body.String())
+	}
+
+	// Route middleware does not leak to sibling routes
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/open", nil))
+	if got := strings.Join(w.Header().Values("X-Chain"), ","); got != "global" {
+		t.Errorf("sibling chain: want global, got %q", got)
+	}
+
+	routes := app.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("Routes: want 2, got %d", len(routes))
+	}
+	if !strings.HasSuffix(routes[0].Handler, ".listUsers") {
+		t.Errorf("Routes: Handler want *.listUsers, got %q", routes[0].Handler)
+	}
+	if len(routes[0].Middleware) != 3 || !strings.Contains(routes[0].Middleware[0], "routeTag") {
+		t.Errorf("Routes: Middleware want 3 routeTag closures, got %v", routes[0].Middleware)
+	}
+}
+
+func TestRouterGroup_NoHandlers(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("GET without handlers should panic")
+		}
+	}()
+	New().GET("/x")
+}
+
+func TestRouterGroup_SiblingsDoNotShareMiddleware(t *testing.T) {
+	app := New()
+	api := app.Group("/api")
+	// Three appends leave spare capacity in the parent's slice
+	api.Use(routeTag("a"))
+	api.Use(routeTag("b"))
+	api.Use(routeTag("c"))
+
+	v1 := api.Group("/v1")
+	v2 := api.Group("/v2")
+	v1.Use(routeTag("v1"))
+	v2.Use(routeTag("v2"))
+	v1.GET("/x", listUsers)
+	v2.GET("/x", listUsers)
+
+	for path, want := range map[string]string{
+		"/api/v1/x": "a,b,c,v1",
+		"/api/v2/x": "a,b,c,v2",
+	} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if got := strings.Join(w.Header().Values("X-Chain"), ","); got != want {
+			t.Errorf("%s: want %s, got %q", path, want, got)
+		}
+	}
+}
+
+func TestEngine_UseAfterRoutes(t *testing.T) {
+	app := New()
+	api := app.Group("/api")
+	api.GET("/x", listUsers)
+	app.GET("/y", listUsers)
+
+	// Registered after the routes, still applied in scope
+	api.Use(routeTag("api"))
+	app.Use(routeTag("global"))
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/api/x", nil))
+	if got := strings.Join(w.Header().Values("X-Chain"), ","); got != "global,api" {
+		t.Errorf("/api/x: want global,api, got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/y", nil))
+	if got := strings.Join(w.Header().Values("X-Chain"), ","); got != "global" {
+		t.Errorf("/y: want global, got %q", got)
+	}
+
+	// Changes after the first request are compiled on the next one
+	app.Use(routeTag("late"))
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/nope", nil))
+	if got := strings.Join(w.Header().Values("X-Chain"), ","); got != "global,late" || w.Code != 404 {
+		t.Errorf("/nope: want 404 global,late, got %d %q", w.Code, got)
+	}
+}
+
+func TestEngine_UseWhileServing(t *testing.T) {
+	app := New()
+	api := app.Group("/api")
+	route := api.GET("/x", listUsers)
+
+	var wg, running sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		running.Add(1)
+		go func() {
+			defer wg.Done()
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/x", nil))
+			running.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, path := range []string{"/api/x", "/nope"} {
+					app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+				}
+			}
+		}()
+	}
+	running.Wait()
+	for i := 0; i < 20; i++ {
+		app.Use(routeTag("global"))
+		api.Use(routeTag("api"))
+		route.Use(routeTag("route"))
+		app.NoRoute(func(c *context.Context) error { return ErrNotFound })
+	}
+	close(stop)
+	wg.Wait()
+
+	// Every change made while serving is compiled
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/api/x", nil))
+	if got := len(w.Header().Values("X-Chain")); got != 60 {
+		t.Errorf("chain after concurrent Use: want 60 middleware, got %d", got)
+	}
+}
+
+type createItem struct {
+	Org     string `uri:"org"`
+	Dry     bool   `query:"dry"`
+	TraceID string `header:"X-Trace-Id"`
+	Name    string `json:"name" validate:"required"`
+}
+
+type itemResp struct {
+	XMLName struct{} `json:"-" xml:"item"`
+	Org     string   `json:"org" xml:"org"`
+	Name    string   `json:"name" xml:"name"`
+	Trace   string   `json:"trace" xml:"trace"`
+	Dry     bool     `json:"dry" xml:"dry"`
+}
+
+func (itemResp) StatusCode() int { return 201 }
+
+func TestHandle(t *testing.T) {
+	app := New()
+	Typed(app.POST, "/orgs/:org/items", func(c *context.Context, req createItem) (itemResp, error) {
+		return itemResp{Org: req.Org, Name: req.Name, Trace: req.TraceID, Dry: req.Dry}, nil
+	})
+
+	post := func(body, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/orgs/acme/items?dry=true", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Trace-Id", "t1")
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	w := post(`{"name":"box"}`, "")
+	if w.Code != 201 || !strings.Contains(w.Body.String(), `"org":"acme"`) ||
+		!strings.Contains(w.Body.String(), `"trace":"t1"`) || !strings.Contains(w.Body.String(), `"dry":true`) {
+		t.Errorf("JSON: want 201 with bound fields, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = post(`{"name":"box"}`, "application/xml;q=0.9, application/json;q=0.5")
+	if ct := w.Header().Get("Content-Type"); ct != "application/xml" || !strings.Contains(w.Body.String(), "<name>box</name>") {
+		t.Errorf("XML: want application/xml, got %q %s", ct, w.Body.String())
+	}
+
+	if w = post(`{"name":"box"}`, "text/csv"); w.Code != 406 {
+		t.Errorf("unacceptable: want 406, got %d", w.Code)
+	}
+	if w = post(`{}`, ""); w.Code != 422 || w.Header().Get("Content-Type") != "application/problem+json" ||
+		!strings.Contains(w.Body.String(), `"errors":[{"field":"name","rule":"required","message":"name is a required field"}]`) {
+		t.Errorf("validation: want 422 problem with field errors, got %d %s", w.Code, w.Body.String())
+	}
+	if w = post(`{"name":`, ""); w.Code != 400 {
+		t.Errorf("malformed body: want 400, got %d", w.Code)
+	}
+
+	routes := app.Routes()
+	if routes[0].Request != reflect.TypeOf(createItem{}) || routes[0].Response != reflect.TypeOf(itemResp{}) {
+		t.Errorf("Routes: want createItem/itemResp types, got %v/%v", routes[0].Request, routes[0].Response)
+	}
+}
+
+func TestHandle_BindErrorsMatchBind(t *testing.T) {
+	app := New()
+	app.POST("/typed", Handle(func(c *context.Context, req createItem) (itemResp, error) {
+		return itemResp{}, nil
+	}))
+	app.POST("/plain", func(c *context.Context) error {
+		var req createItem
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		return c.String(200, "ok")
+	})
+
+	for _, tc := range []struct{ contentType, body string }{
+		{"text/plain", "box"},                // 415
+		{"application/json", `{"name":`},     // 400
+		{"application/xml", "<createItem><"}, // 400
+	} {
+		var got [2]string
+		for i, path := range []string{"/typed", "/plain"} {
+			r := httptest.NewRequest("POST", path, strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+			got[i] = fmt.Sprintf("%d %s", w.Code, w.Body.String())
+		}
+		if got[0] != got[1] {
+			t.Errorf("%s: Handle and Bind differ: %q vs %q", tc.contentType, got[0], got[1])
+		}
+	}
+}
+
+func TestHandle_QueryDoesNotOverrideFormBody(t *testing.T) {
+	type signup struct {
+		Name string `form:"name"`
+		Role string `form:"role"`
+		Ref  string `query:"ref"`
+	}
+	app := New()
+	app.POST("/signup", Handle(func(c *context.Context, req signup) (signup, error) {
+		return req, nil
+	}))
+
+	r := httptest.NewRequest("POST", "/signup?role=admin&ref=ad", strings.NewReader("name=ann&role=user"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `{"Name":"ann","Role":"user","Ref":"ad"}` {
+		t.Errorf("want role from the body and ref from the query, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandle_EncodeError(t *testing.T) {
+	app := New()
+	app.GET("/m", Handle(func(c *context.Context, req struct{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"a": 1}, nil
+	}))
+
+	r := httptest.NewRequest("GET", "/m", nil)
+	r.Header.Set("Accept", "application/xml") // maps cannot be encoded as XML
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+	if w.Code != 500 || w.Body.Len() == 0 {
+		t.Errorf("want a 500 error response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestTyped_RouteTypes(t *testing.T) {
+	app := New()
+	api := app.Group("/api")
+	// Pointer types share the instantiation's code; each route keeps its own types
+	Typed(app.GET, "/a", func(c *context.Context, req *createItem) (*itemResp, error) { return nil, nil })
+	Typed(api.POST, "/b", func(c *context.Context, req *itemResp) (*createItem, error) { return nil, nil }, routeTag("mw"))
+	app.GET("/untyped", Handle(func(c *context.Context, req createItem) (itemResp, error) { return itemResp{}, nil }))
+	app.GET("/plain", listUsers)
+
+	want := []struct {
+		path      string
+		req, resp reflect.Type
+		mw        int
+	}{
+		{"/a", reflect.TypeOf(&createItem{}), reflect.TypeOf(&itemResp{}), 0},
+		{"/api/b", reflect.TypeOf(&itemResp{}), reflect.TypeOf(&createItem{}), 1},
+		{"/untyped", nil, nil, 0},
+		{"/plain", nil, nil, 0},
+	}
+	for i, r := range app.Routes() {
+		if r.Path != want[i].path || r.Request != want[i].req || r.Response != want[i].resp || len(r.Middleware) != want[i].mw {
+			t.Errorf("%s: want %s %v/%v with %d middleware, got %v/%v with %v",
+				r.Path, want[i].path, want[i].req, want[i].resp, want[i].mw, r.Request, r.Response, r.Middleware)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/b", strings.NewReader(`{"name":"box"}`))
+	app.ServeHTTP(w, r)
+	if w.Code != 200 || w.Header().Get("X-Chain") != "mw" {
+		t.Errorf("Typed route: want 200 through its middleware, got %d %v", w.Code, w.Header())
+	}
+}
+
+type plainRenderer struct{}
+
+func (plainRenderer) ContentType() string { return "text/plain" }
+
+func (plainRenderer) Render(w io.Writer, obj interface{}) error {
+	_, err := fmt.Fprintf(w, "%+v", obj)
+	return err
+}
+
+func TestEngine_RegisterRenderer(t *testing.T) {
+	app := New()
+	app.RegisterRenderer("text/plain", plainRenderer{})
+	app.GET("/item", Handle(func(c *context.Context, _ struct{}) (itemResp, error) {
+		return itemResp{Name: "box"}, nil
+	}))
+	app.GET("/list", func(c *context.Context) error {
+		return c.Negotiate(200, []string{"a", "b"}, "application/json", "application/yaml")
+	})
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+	if w := get("/item", "text/plain"); w.Code != 201 || !strings.Contains(w.Body.String(), "Name:box") {
+		t.Errorf("registered renderer: want 201 text, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/item", "application/yaml"); w.Header().Get("Content-Type") != "application/yaml" {
+		t.Errorf("YAML: got %s", w.Header().Get("Content-Type"))
+	}
+	if w := get("/list", "application/yaml"); w.Body.String() != "- a\n- b\n" {
+		t.Errorf("Negotiate: want YAML list, got %q", w.Body.String())
+	}
+	if w := get("/list", "text/plain"); w.Code != 406 {
+		t.Errorf("Negotiate outside offers: want 406, got %d", w.Code)
+	}
+}
+
+func TestEngine_Host(t *testing.T) {
+	app := New()
+	app.Use(routeTag("global"))
+	app.Host("api.example.com").GET("/users", func(c *context.Context) error {
+		return c.String(200, "api")
+	})
+	tenant := app.Host(":tenant.example.com")
+	tenant.GET("/users/:id", func(c *context.Context) error {
+		return c.String(200, c.Param("tenant")+"/"+c.Param("id"))
+	})
+	tenant.POST("/users", listUsers)
+	app.GET("/users", func(c *context.Context) error {
+		return c.String(200, "fallback")
+	})
+
+	cases := []struct {
+		method, host, path string
+		code               int
+		body               string
+	}{
+		{"GET", "api.example.com", "/users", 200, "api"},
+		{"GET", "API.example.com:8080", "/users", 200, "api"}, // case and port ignored
+		{"GET", "acme.example.com", "/users/7", 200, "acme/7"},
+		{"GET", "acme.example.com", "/users", 200, "fallback"}, // host tree miss
+		{"GET", "other.org", "/users", 200, "fallback"},
+		{"GET", "a.b.example.com", "/users/7", 404, ""},
+		{"DELETE", "acme.example.com", "/users", 405, ""},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		r.Host = tc.host
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s %s%s: want %d %q, got %d %q", tc.method, tc.host, tc.path, tc.code, tc.body, w.Code, w.Body.String())
+		}
+		if tc.code == 200 && w.Header().Get("X-Chain") != "global" {
+			t.Errorf("%s%s: global middleware did not run", tc.host, tc.path)
+		}
+		if tc.code == 405 && w.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+			t.Errorf("Allow: want host and fallback methods merged, got %q", w.Header().Get("Allow"))
+		}
+	}
+
+	routes := app.Routes()
+	if routes[0].Host != "api.example.com" || routes[1].Host != ":tenant.example.com" || routes[3].Host != "" {
+		t.Errorf("Routes: hosts not reported, got %+v", routes)
+	}
+}
+
+func TestEngine_RedirectTrailingSlash(t *testing.T) {
+	app := New()
+	app.GET("/users", listUsers)
+	app.POST("/items/", listUsers)
+
+	cases := []struct {
+		method, target string
+		code           int
+		location       string
+	}{
+		{"GET", "/users/", 301, "/users"},
+		{"GET", "/users/?page=2", 301, "/users?page=2"},
+		{"POST", "/items", 308, "/items/"},
+		{"GET", "/USERS", 404, ""}, // fixed path is off by default
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+		if w.Code != tc.code || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s: want %d %q, got %d %q", tc.method, tc.target, tc.code, tc.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	app.RedirectTrailingSlash = false
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/users/", nil))
+	if w.Code != 404 {
+		t.Errorf("disabled: want 404, got %d", w.Code)
+	}
+}
+
+func TestEngine_RedirectFixedPath(t *testing.T) {
+	app := New()
+	app.RedirectFixedPath = true
+	app.GET("/users/:id/Profile", listUsers)
+
+	cases := []struct {
+		target, location string
+	}{
+		{"/USERS/Bob/profile", "/users/Bob/Profile"},
+		{"/users//Bob/./x/../Profile", "/users/Bob/Profile"},
+		{"/users/Bob/profile/", "/users/Bob/Profile"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = tc.target
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		if w.Code != 301 || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s: want 301 %q, got %d %q", tc.target, tc.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestEngine_UseRawPath(t *testing.T) {
+	app := New()
+	app.GET("/files/:name", func(c *context.Context) error {
+		return c.String(200, c.Param("name"))
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/files/a%2Fb", nil))
+	if w.Code != 404 {
+		t.Errorf("decoded path: want 404, got %d", w.Code)
+	}
+
+	app.UseRawPath = true
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/files/a%2Fb", nil))
+	if w.Code != 200 || w.Body.String() != "a/b" {
+		t.Errorf("raw path: want 200 a/b, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestEngine_MixedAndOptionalParams(t *testing.T) {
+	app := New()
+	app.GET("/files/:name.:ext", func(c *context.Context) error {
+		return c.String(200, c.Param("name")+"|"+c.Param("ext"))
+	}).Name("file")
+	app.GET("/posts/:page?", func(c *context.Context) error {
+		return c.String(200, "page="+c.Param("page"))
+	}).Name("posts")
+
+	for path, want := range map[string]string{
+		"/files/report.pdf": "report|pdf",
+		"/posts/3":          "page=3",
+		"/posts":            "page=",
+	} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 || w.Body.String() != want {
+			t.Errorf("%s: want %q, got %d %q", path, want, w.Code, w.Body.String())
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"file", []interface{}{"report", "pdf"}, "/files/report.pdf"},
+		{"posts", []interface{}{2}, "/posts/2"},
+		{"posts", nil, "/posts"},
+	} {
+		if got, err := app.URL(tc.name, tc.params...); err != nil || got != tc.want {
+			t.Errorf("URL(%s, %v): want %s, got %q %v", tc.name, tc.params, tc.want, got, err)
+		}
+	}
+}
+
+func TestEngine_Validate(t *testing.T) {
+	app := New()
+	h := func(c *context.Context) error { return nil }
+	app.GET("/users/:id", h).Name("user").Desc("Show a user")
+	// shadowed: same requests as /users/:id
+	app.GET("/users/:name", h).Name("byName").Desc("Find by name").Use(routeTag("mw"))
+	app.GET("/users/:uid/posts", h)    // conflicts: different param name
+	app.GET("/users/:id<int>/edit", h) // a constrained param is fine
+	app.GET("/files/:a<", h)           // invalid pattern
+
+	err := app.Validate()
+	if err == nil {
+		t.Fatal("Validate: want error")
+	}
+	var routeErrs []*RouteError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var re *RouteError
+		if !errors.As(e, &re) {
+			t.Fatalf("want *RouteError, got %T", e)
+		}
+		routeErrs = append(routeErrs, re)
+	}
+	if len(routeErrs) != 3 {
+		t.Fatalf("want 3 route errors, got %d: %v", len(routeErrs), err)
+	}
+
+	shadowed, conflict, invalid := routeErrs[0], routeErrs[1], routeErrs[2]
+	if !shadowed.Shadowed || shadowed.Existing == nil || shadowed.Existing.Path != "/users/:id" {
+		t.Errorf("shadowed: got %+v", shadowed)
+	}
+	if conflict.Shadowed || conflict.Existing == nil || conflict.Existing.Path != "/users/:id" {
+		t.Errorf("conflict: got %+v", conflict)
+	}
+	if invalid.Existing != nil {
+		t.Errorf("invalid: got Existing %v", invalid.Existing.Path)
+	}
+	msg := err.Error()
+	for _, want := range []string{"is shadowed by GET /users/:id (", "conflicts with GET /users/:id (", "kvolt_test.go:"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+	routes := app.Routes()
+	if len(routes) != 2 {
+		t.Errorf("want 2 registered routes, got %d", len(routes))
+	}
+
+	// The route returned for a failed registration is detached
+	if u, err := app.URL("byName", "ada"); err == nil {
+		t.Errorf("URL of a failed route: want error, got %q", u)
+	}
+	if routes[0].Name != "user" || routes[0].Summary != "Show a user" {
+		t.Errorf("existing route: want name and summary kept, got %q %q", routes[0].Name, routes[0].Summary)
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/users/7", nil))
+	if len(w.Header().Values("X-Chain")) != 0 {
+		t.Errorf("existing route: got middleware of the failed route %v", w.Header().Values("X-Chain"))
+	}
+	if err := app.Server(ServerConfig{Addr: "127.0.0.1:0"}); err == nil {
+		t.Error("Server: want validation error")
+	}
+}
+
+func TestRouterGroup_Register(t *testing.T) {
+	app := New()
+	h := func(c *context.Context) error { return c.String(200, "ok") }
+	route, err := app.Group("/api").Register("GET", "/items/:id", h)
+	if err != nil || route.Path != "/api/items/:id" {
+		t.Fatalf("Register: got %v, %v", route, err)
+	}
+	if !strings.Contains(route.Source, "kvolt_test.go:") {
+		t.Errorf("Source = %q, want this file", route.Source)
+	}
+	if _, err := app.Register("GET", "/api/items/:key", h); err == nil {
+		t.Error("Register: want conflict error")
+	}
+	if err := app.Validate(); err != nil {
+		t.Errorf("Validate: strict errors should not be recorded, got %v", err)
+	}
+}
+
+func TestEngine_RemoveAndReplaceRoute(t *testing.T) {
+	app := New()
+	say := func(s string) context.HandlerFunc {
+		return func(c *context.Context) error { return c.String(200, s) }
+	}
+	tenants := app.Group("/t")
+	tenants.GET("/:id/hello", say("v1")).Name("hello")
+	app.Build()
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	route, err := tenants.ReplaceRoute("GET", "/:id/hello", say("v2"))
+	if err != nil || route.Path != "/t/:id/hello" {
+		t.Fatalf("ReplaceRoute: %v", err)
+	}
+	if code, body := get("/t/1/hello"); code != 200 || body != "v2" {
+		t.Errorf("after ReplaceRoute: got %d %q", code, body)
+	}
+	if u, err := app.URL("hello", 1); err != nil || u != "/t/1/hello" {
+		t.Errorf("name not kept by ReplaceRoute: %q %v", u, err)
+	}
+	if len(app.Routes()) != 1 {
+		t.Errorf("Routes after ReplaceRoute: %+v", app.Routes())
+	}
+	if _, err := app.ReplaceRoute("GET", "/missing", say("x")); err == nil {
+		t.Error("ReplaceRoute of a missing route: want error")
+	}
+
+	if !tenants.RemoveRoute("GET", "/:id/hello") {
+		t.Fatal("RemoveRoute: want true")
+	}
+	if tenants.RemoveRoute("GET", "/:id/hello") {
+		t.Error("second RemoveRoute: want false")
+	}
+	if code, _ := get("/t/1/hello"); code != 404 {
+		t.Errorf("after RemoveRoute: got %d, want 404", code)
+	}
+	if len(app.Routes()) != 0 {
+		t.Errorf("Routes after RemoveRoute: %+v", app.Routes())
+	}
+	if _, err := app.URL("hello", 1); err == nil {
+		t.Error("URL of a removed route: want error")
+	}
+}
+
+func TestEngine_RemovedRouteIsDetached(t *testing.T) {
+	app := New()
+	noop := func(c *context.Context) error { return nil }
+	removed := app.GET("/users/:id", noop)
+	if !app.RemoveRoute("GET", "/users/:id") {
+		t.Fatal("RemoveRoute: want true")
+	}
+	removed.Name("user")
+	if _, err := app.URL("user", 1); err == nil {
+		t.Error("Name on a removed route: want it ignored")
+	}
+
+	replaced := app.GET("/orders/:id", noop).Name("order")
+	if _, err := app.ReplaceRoute("GET", "/orders/:id", noop); err != nil {
+		t.Fatalf("ReplaceRoute: %v", err)
+	}
+	replaced.Name("stale")
+	if _, err := app.URL("stale", 1); err == nil {
+		t.Error("Name on a replaced route: want it ignored")
+	}
+	if u, err := app.URL("order", 1); err != nil || u != "/orders/1" {
+		t.Errorf("name of the replacement: %q %v", u, err)
+	}
+}
+
+func TestEngine_RoutesChangeWhileServing(t *testing.T) {
+	app := New()
+	app.GET("/ping", func(c *context.Context) error { return c.String(200, "pong") })
+	app.Build()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			tenant := app.Host(fmt.Sprintf("t%d.example.com", i%5))
+			tenant.GET("/hello", func(c *context.Context) error { return c.String(200, "hi") })
+			tenant.RemoveRoute("GET", "/hello")
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.Host = fmt.Sprintf("t%d.example.com", i%5)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if w.Code != 200 || w.Body.String() != "pong" {
+			t.Fatalf("/ping: got %d %q", w.Code, w.Body.String())
+		}
+	}
+	wg.Wait()
+}
+
+// nopWriter is a ResponseWriter that discards the response without allocating.
+type nopWriter struct{ header http.Header }
+
+func (w *nopWriter) Header() http.Header         { return w.header }
+func (w *nopWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *nopWriter) WriteHeader(int)             {}
+
+func benchEngine() *Engine {
+	app := New()
+	nop := func(c *context.Context) error { return nil }
+	app.GET("/api/v1/health", nop)
+	app.GET("/users/:id/posts/:post", nop)
+	app.GET("/assets/*filepath", nop)
+	app.Host(":tenant.example.com").GET("/hello", nop)
+	app.Build()
+	return app
+}
+
+var benchRequests = []struct{ name, path, host string }{
+	{"Static", "/api/v1/health", ""},
+	{"Param", "/users/42/posts/7", ""},
+	{"CatchAll", "/assets/css/site.css", ""},
+	{"Host", "/hello", "acme.example.com:8080"},
+}
+
+func benchRequest(path, host string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	if host != "" {
+		req.Host = host
+	}
+	return req
+}
+
+func TestEngine_ServeHTTPZeroAlloc(t *testing.T) {
+	app := benchEngine()
+	w := &nopWriter{header: make(http.Header)}
+	for _, br := range benchRequests {
+		req := benchRequest(br.path, br.host)
+		app.ServeHTTP(w, req) // warm the context pool
+		if allocs := testing.AllocsPerRun(100, func() { app.ServeHTTP(w, req) }); allocs != 0 {
+			t.Errorf("%s: %v allocs per request, want 0", br.name, allocs)
+		}
+	}
+}
+
+func BenchmarkEngine_ServeHTTP(b *testing.B) {
+	app := benchEngine()
+	w := &nopWriter{header: make(http.Header)}
+	for _, br := range benchRequests {
+		b.Run(br.name, func(b *testing.B) {
+			req := benchRequest(br.path, br.host)
+			b.ReportAllocs()
+			for b.Loop() {
+				app.ServeHTTP(w, req)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package kvolt
+
+import (
+	stdContext "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// DefaultHookTimeout bounds a single lifecycle hook unless Hook.Timeout overrides it.
+const DefaultHookTimeout = 10 * time.Second
+
+// HookFunc is a lifecycle callback. ctx expires after the hook's timeout.
+type HookFunc func(ctx stdContext.Context) error
+
+// Hook is a registered OnStart or OnShutdown callback.
+type Hook struct {
+	name    string
+	fn      HookFunc
+	timeout time.Duration
+	order   int
+	seq     int   // registration order, breaks ties
+	start   *Hook // for a Manage stop hook: runs only if start completed
+	done    bool  // start hook completed
+}
+
+// Name labels the hook in error messages.
+func (h *Hook) Name(name string) *Hook {
+	h.name = name
+	return h
+}
+
+// Timeout overrides DefaultHookTimeout for this hook.
+func (h *Hook) Timeout(d time.Duration) *Hook {
+	h.timeout = d
+	return h
+}
+
+// Order sets the hook priority. Start hooks run in ascending order and
+// shutdown hooks in descending order; equal orders fall back to
+// registration order (reversed for shutdown). Default: 0.
+func (h *Hook) Order(order int) *Hook {
+	h.order = order
+	return h
+}
+
+// run executes the hook, giving up when its timeout expires.
+func (h *Hook) run(parent stdContext.Context) error {
+	timeout := h.timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := stdContext.WithTimeout(parent, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- h.fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		name := h.name
+		if name == "" {
+			name = fmt.Sprintf("#%d", h.seq)
+		}
+		return fmt.Errorf("kvolt: hook %s: %w", name, err)
+	}
+	return nil
+}
+
+// OnStart registers a hook that runs before the server accepts connections.
+// If any start hook fails, the server does not start and shutdown hooks run,
+// except the Stop of services (see Manage) whose Start did not complete.
+func (e *Engine) OnStart(fn HookFunc) *Hook {
+	h := &Hook{fn: fn, seq: len(e.startHooks) + len(e.shutdownHooks)}
+	e.startHooks = append(e.startHooks, h)
+	return h
+}
+
+// OnShutdown registers a hook that runs after the listeners are closed and
+// in-flight requests have drained. Hooks run in reverse registration order,
+// so subsystems stop in the opposite order they were started.
+func (e *Engine) OnShutdown(fn HookFunc) *Hook {
+	h := &Hook{fn: fn, seq: len(e.startHooks) + len(e.shutdownHooks)}
+	e.shutdownHooks = append(e.shutdownHooks, h)
+	return h
+}
+
+// Service is a background subsystem with a blocking-free Start and a
+// graceful Stop, such as queue.MemoryQueue or scheduler.Scheduler.
+type Service interface {
+	Start()
+	Stop()
+}
+
+// Manage ties a Service to the engine lifecycle: Start runs with the start
+// hooks and Stop runs with the shutdown hooks, in reverse start order.
+// Stop is skipped when Start never ran, e.g. because an earlier start hook
+// failed.
+func (e *Engine) Manage(name string, svc Service) {
+	start := e.OnStart(func(stdContext.Context) error {
+		svc.Start()
+		return nil
+	}).Name(name + " start")
+	e.OnShutdown(func(stdContext.Context) error {
+		svc.Stop()
+		return nil
+	}).Name(name + " stop").start = start
+}
+
+// runStartHooks runs start hooks in ascending order, stopping at the first error.
+func (e *Engine) runStartHooks(ctx stdContext.Context) error {
+	hooks := append([]*Hook(nil), e.startHooks...)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].order < hooks[j].order
+	})
+	for _, h := range hooks {
+		if err := h.run(ctx); err != nil {
+			return err
+		}
+		h.done = true
+	}
+	return nil
+}
+
+// runShutdownHooks runs the shutdown hooks in descending order and joins
+// their errors. Stop hooks of services whose start hook did not complete
+// are skipped.
+func (e *Engine) runShutdownHooks(ctx stdContext.Context) error {
+	hooks := append([]*Hook(nil), e.shutdownHooks...)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].order != hooks[j].order {
+			return hooks[i].order > hooks[j].order
+		}
+		return hooks[i].seq > hooks[j].seq
+	})
+	var errs []error
+	for _, h := range hooks {
+		if h.start != nil && !h.start.done {
+			continue
+		}
+		errs = append(errs, h.run(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Ready reports whether the engine is serving and not shutting down.
+func (e *Engine) Ready() bool {
+	return e.ready.Load()
+}
+
+// ReadinessHandler returns a handler for load balancer probes (e.g. "/readyz").
+// It answers 200 while the engine is ready and 503 once shutdown has begun.
+func (e *Engine) ReadinessHandler() context.HandlerFunc {
+	return func(c *context.Context) error {
+		if !e.Ready() {
+			return c.String(http.StatusServiceUnavailable, "Shutting Down")
+		}
+		return c.String(http.StatusOK, "OK")
+	}
+}
@@ -9,13 +9,32 @@ import (
 	"github.com/go-kvolt/kvolt/context"
 )
 
+// gzipWriter compresses the body; status, hooks and hijacking go through
+// the wrapped writer.
 type gzipWriter struct {
-	http.ResponseWriter
-	Writer io.Writer
+	context.ResponseWriter
+	gz *gzip.Writer
 }
 
 func (w gzipWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+	return w.gz.Write(b)
+}
+
+// ReadFrom compresses r; the wrapped ReadFrom would bypass the compressor.
+func (w gzipWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(w.gz, r)
+}
+
+// Flush sends the data compressed so far, so streamed responses (c.Stream,
+// c.SSE) reach the client through the compressor.
+func (w gzipWriter) Flush() {
+	_ = w.gz.Flush()
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap gives http.ResponseController access to the original writer.
+func (w gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 // Gzip returns a middleware that compresses HTTP responses.
@@ -27,21 +46,21 @@ func Gzip() func(c *context.Context) error {
 			return nil
 		}
 
-		// Wrap writer
-		gz := gzip.NewWriter(c.Writer)
+		origWriter := c.Writer
+		gz := gzip.NewWriter(origWriter)
 		defer gz.Close()
 
-		c.Writer.Header().Set("Content-Encoding", "gzip")
-		c.Writer.Header().Set("Vary", "Accept-Encoding")
-
-		// Replace writer in context
-		origWriter := c.Writer
-		c.Writer = gzipWriter{ResponseWriter: origWriter, Writer: gz}
+		header := origWriter.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Vary", "Accept-Encoding")
+		// A length set by the handler is the uncompressed one
+		origWriter.Before(func() { header.Del("Content-Length") })
 
+		c.Writer = gzipWriter{ResponseWriter: origWriter, gz: gz}
 		c.Next()
 
-		// Ensure flush
-		// gz.Close() is called by defer, but we need to ensure size logic works if we add it later
+		// Outer middleware should see the writer they passed in
+		c.Writer = origWriter
 		return nil
 	}
 }
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	stdContext "context"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kvolt/kvolt/context"
@@ -11,6 +14,9 @@ var (
 	// Buffered channel to prevent blocking the request handler
 	// Size 10000 means we can burst 10k logs before blocking/dropping
 	logChan = make(chan string, 10000)
+
+	// pendingLogs counts queued messages not yet written
+	pendingLogs atomic.Int64
 )
 
 func init() {
@@ -18,37 +24,67 @@ func init() {
 	go func() {
 		for msg := range logChan {
 			fmt.Print(msg)
+			pendingLogs.Add(-1)
 		}
 	}()
 }
 
-// Logger returns a middleware that logs HTTP requests asynchronously.
+// FlushLogs blocks until all queued request logs are written or ctx is done.
+// Register it as a shutdown hook so the last requests are not lost:
+//
+//	app.OnShutdown(middleware.FlushLogs)
+func FlushLogs(ctx stdContext.Context) error {
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for pendingLogs.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Logger returns a middleware that logs HTTP requests asynchronously,
+// with the errors recorded in c.Errors during the request.
 func Logger() func(c *context.Context) error {
 	return func(c *context.Context) error {
 		start := time.Now()
 
 		c.Next()
 
-		latency := time.Since(start)
-
-		// Format message
-		timestamp := time.Now().Format("2006/01/02 - 15:04:05")
-		msg := fmt.Sprintf("[KVolt] %s | %3d | %13v | %15s | %-7s %s\n",
-			timestamp,
-			200, // TODO: c.Response.Status check
-			latency,
-			c.Request.RemoteAddr,
-			c.Request.Method,
-			c.Request.URL.Path,
-		)
+		msg := logLine(c, time.Since(start), time.Now())
 
 		// Non-blocking send
+		pendingLogs.Add(1)
 		select {
 		case logChan <- msg:
 		default:
 			// Channel full, drop log to preserve server stability
+			pendingLogs.Add(-1)
 		}
 
 		return nil
 	}
 }
+
+// logLine formats the log line of a finished request.
+func logLine(c *context.Context, latency time.Duration, now time.Time) string {
+	msg := fmt.Sprintf("[KVolt] %s | %3d | %13v | %15s | %-7s %s",
+		now.Format("2006/01/02 - 15:04:05"),
+		c.Writer.Status(),
+		latency,
+		c.Request.RemoteAddr,
+		c.Request.Method,
+		c.Request.URL.Path,
+	)
+	if len(c.Errors) > 0 {
+		errs := make([]string, len(c.Errors))
+		for i, err := range c.Errors {
+			errs[i] = err.Error()
+		}
+		msg += " | " + strings.Join(errs, "; ")
+	}
+	return msg + "\n"
+}
@@ -1,8 +1,16 @@
 package middleware
 
 import (
+	"bufio"
+	"compress/gzip"
+	stdContext "context"
+	"errors"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kvolt/kvolt/context"
 )
@@ -48,6 +56,11 @@ func TestRecovery(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/", nil)
 	c := context.New(w, r)
+	var handled error
+	c.ErrorHandler = func(c *context.Context, err error) {
+		handled = err
+		c.String(500, "handled")
+	}
 	panicMsg := "test panic"
 	c.Handlers = []context.HandlerFunc{
 		func(c *context.Context) error {
@@ -60,8 +73,32 @@ func TestRecovery(t *testing.T) {
 	if w.Code != 500 {
 		t.Errorf("Recovery: want status 500, got %d", w.Code)
 	}
-	if w.Body.String() != "Internal Server Error" {
-		t.Errorf("Recovery: body want Internal Server Error, got %s", w.Body.String())
+	if w.Body.String() != "handled" || handled == nil || handled.Error() != "panic: test panic" {
+		t.Errorf("Recovery: want the panic rendered by the error handler, got %q (%v)", w.Body.String(), handled)
+	}
+	if !c.IsAborted() || len(c.Errors) != 1 || c.Errors[0].Error() != "panic: test panic" {
+		t.Errorf("Recovery: want the panic recorded and the chain aborted, got %v", c.Errors)
+	}
+
+	// Once the response has started only the error is recorded
+	w = httptest.NewRecorder()
+	c = context.New(w, r)
+	handled = nil
+	c.ErrorHandler = func(c *context.Context, err error) { handled = err }
+	c.Handlers = []context.HandlerFunc{
+		func(c *context.Context) error {
+			c.String(200, "partial")
+			panic(panicMsg)
+		},
+	}
+
+	Recovery()(c)
+
+	if w.Code != 200 || w.Body.String() != "partial" || handled != nil {
+		t.Errorf("Recovery: want the started response untouched, got %d %q (%v)", w.Code, w.Body.String(), handled)
+	}
+	if len(c.Errors) != 1 || c.Errors[0].Error() != "panic: test panic" {
+		t.Errorf("Recovery: want the panic recorded, got %v", c.Errors)
 	}
 }
 
@@ -87,3 +124,255 @@ func TestMaxBodySizeBytes(t *testing.T) {
 		t.Errorf("MaxBodySizeBytes: want 200, got %d", w.Code)
 	}
 }
+
+func TestFromStd(t *testing.T) {
+	headerMW := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Std", "1")
+			next.ServeHTTP(w, r.WithContext(stdContext.WithValue(r.Context(), ctxKey("trace"), "abc")))
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	c := context.New(w, r)
+	c.Handlers = []context.HandlerFunc{
+		FromStd(headerMW),
+		func(c *context.Context) error {
+			return c.String(200, c.Request.Context().Value(ctxKey("trace")).(string))
+		},
+	}
+	c.Next()
+
+	if w.Header().Get("X-Std") != "1" || w.Body.String() != "abc" {
+		t.Errorf("FromStd: want header and trace value, got %q %q", w.Header().Get("X-Std"), w.Body.String())
+	}
+	if c.Request != r {
+		t.Error("FromStd: original request should be restored after the chain")
+	}
+}
+
+func TestFromStd_ShortCircuit(t *testing.T) {
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+
+	called := false
+	w := httptest.NewRecorder()
+	c := context.New(w, httptest.NewRequest("GET", "/", nil))
+	c.Handlers = []context.HandlerFunc{
+		FromStd(deny),
+		func(c *context.Context) error { called = true; return nil },
+	}
+	c.Next()
+
+	if called || w.Code != http.StatusForbidden {
+		t.Errorf("FromStd short-circuit: want 403 without handler, got %d called=%v", w.Code, called)
+	}
+}
+
+type ctxKey string
+
+func TestGzip_Stream(t *testing.T) {
+	pr, pw := io.Pipe()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := context.New(w, r)
+		c.Handlers = []context.HandlerFunc{
+			Gzip(),
+			func(c *context.Context) error {
+				if err := c.SSE("tick", "1"); err != nil {
+					return err
+				}
+				_, _ = io.ReadAll(pr) // hold the stream open until the client read the event
+				return nil
+			},
+		}
+		c.Next()
+	}))
+	defer srv.Close()
+	defer pw.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip header not flushed: %v", err)
+	}
+	line, err := bufio.NewReader(gz).ReadString('\n')
+	if err != nil || line != "event: tick\n" {
+		t.Errorf("Gzip stream: want the first event before the handler returns, got %q %v", line, err)
+	}
+}
+
+func TestGzip_Writer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := context.New(w, r)
+		var status int
+		c.Handlers = []context.HandlerFunc{
+			func(c *context.Context) error {
+				c.Next()
+				status = c.Writer.Status()
+				w.Header().Set("X-Status", "unused") // headers are sent by now
+				return nil
+			},
+			Gzip(),
+			func(c *context.Context) error {
+				if r.URL.Path == "/hijack" {
+					conn, buf, err := c.Writer.Hijack()
+					if err != nil {
+						return err
+					}
+					defer conn.Close()
+					buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+					return buf.Flush()
+				}
+				c.Writer.Header().Set("Content-Length", "5")
+				return c.String(http.StatusCreated, "hello")
+			},
+		}
+		c.Next()
+		if r.URL.Path != "/hijack" && status != http.StatusCreated {
+			t.Errorf("Status behind Gzip: want 201, got %d", status)
+		}
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || string(body) != "hello" || resp.Header.Get("Content-Length") == "5" {
+		t.Errorf("Gzip: want 201 hello without the uncompressed length, got %d %q %q", resp.StatusCode, body, resp.Header.Get("Content-Length"))
+	}
+
+	req, _ = http.NewRequest("GET", srv.URL+"/hijack", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("Hijack behind Gzip: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("Hijack behind Gzip: want ok, got %q", body)
+	}
+}
+
+func TestLogger_Line(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := context.New(w, httptest.NewRequest("POST", "/orders", nil))
+	c.Handlers = []context.HandlerFunc{
+		func(c *context.Context) error {
+			c.Error(errors.New("cache miss"))
+			return c.AbortWithError(http.StatusConflict, errors.New("duplicate order"))
+		},
+	}
+	c.Next()
+
+	line := logLine(c, time.Millisecond, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if !strings.HasPrefix(line, "[KVolt] 2026/01/02 - 03:04:05 | 409 |") ||
+		!strings.HasSuffix(line, "| POST    /orders | cache miss; duplicate order\n") {
+		t.Errorf("logLine: got %q", line)
+	}
+}
+
+func TestTimeout_ErrorsBeforeTimeout(t *testing.T) {
+	early, late := errors.New("early"), errors.New("late")
+	c := context.New(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	c.Handlers = []context.HandlerFunc{
+		func(c *context.Context) error {
+			c.Error(early)
+			c.Next()
+			return nil
+		},
+		Timeout(time.Second),
+		func(c *context.Context) error {
+			c.Error(late)
+			return c.String(200, "ok")
+		},
+	}
+	c.Next()
+	if len(c.Errors) != 2 || c.Errors[0] != early || c.Errors[1] != late {
+		t.Errorf("Errors: want [early late], got %v", c.Errors)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	// Fast handler: the buffered response is sent as written
+	w := httptest.NewRecorder()
+	c := context.New(w, httptest.NewRequest("GET", "/", nil))
+	var hasDeadline bool
+	c.Handlers = []context.HandlerFunc{
+		Timeout(time.Second),
+		func(c *context.Context) error {
+			_, hasDeadline = c.Deadline()
+			c.Set("user", "ada")
+			c.Writer.Header().Set("X-Request-Id", "42")
+			return c.String(http.StatusCreated, "done")
+		},
+	}
+	c.Next()
+	if w.Code != 201 || w.Body.String() != "done" || w.Header().Get("X-Request-Id") != "42" ||
+		!hasDeadline || c.Value("user") != "ada" {
+		t.Errorf("Timeout fast: got %d %q, deadline %v, user %v", w.Code, w.Body.String(), hasDeadline, c.Value("user"))
+	}
+
+	// Slow handler: 503 through the error handler, its late write is dropped
+	w = httptest.NewRecorder()
+	c = context.New(w, httptest.NewRequest("GET", "/", nil))
+	lateWrite := make(chan error, 4)
+	c.Handlers = []context.HandlerFunc{
+		Timeout(10 * time.Millisecond),
+		func(c *context.Context) error {
+			<-c.Done()
+			_, err := c.Writer.Write([]byte("late"))
+			lateWrite <- err
+			// The request's writer is out of reach too
+			lateWrite <- http.NewResponseController(c.Writer).SetWriteDeadline(time.Now())
+			lateWrite <- http.NewResponseController(c.Writer).EnableFullDuplex()
+			if c.Writer.Unwrap() != nil {
+				lateWrite <- errors.New("Unwrap returned the request's writer")
+			}
+			close(lateWrite)
+			return nil
+		},
+	}
+	c.Next()
+	for err := range lateWrite {
+		if !errors.Is(err, http.ErrHandlerTimeout) {
+			t.Errorf("Timeout slow: late write want ErrHandlerTimeout, got %v", err)
+		}
+	}
+	var se *context.StatusError
+	if w.Code != 503 || !strings.Contains(w.Body.String(), "Service Unavailable") || !c.IsAborted() ||
+		len(c.Errors) != 1 || !errors.As(c.Errors[0], &se) || !errors.Is(se, stdContext.DeadlineExceeded) {
+		t.Errorf("Timeout slow: want 503 with DeadlineExceeded recorded, got %d %q %v", w.Code, w.Body.String(), c.Errors)
+	}
+
+	// Panics reach Recovery on the request goroutine
+	w = httptest.NewRecorder()
+	c = context.New(w, httptest.NewRequest("GET", "/", nil))
+	c.Handlers = []context.HandlerFunc{
+		Recovery(),
+		Timeout(time.Second),
+		func(c *context.Context) error { panic("boom") },
+	}
+	c.Next()
+	if w.Code != 500 {
+		t.Errorf("Timeout panic: want 500 from Recovery, got %d", w.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"log"
 	"runtime"
 
@@ -25,18 +26,25 @@ func Recovery() func(c *context.Context) error {
 }
 
 // RecoveryWithConfig returns a middleware that recovers from panic with the given config.
+// The panic is recorded in c.Errors and the chain is aborted; unless a
+// response was already started, it is rendered by the error handler.
 func RecoveryWithConfig(config RecoveryConfig) func(c *context.Context) error {
 	return func(c *context.Context) error {
 		defer func() {
 			if err := recover(); err != nil {
+				c.Abort()
 				log.Printf("[Panic] %v", err)
 				if config.LogStackTrace {
 					buf := make([]byte, 4096)
 					n := runtime.Stack(buf, false)
 					log.Printf("[Panic] stack:\n%s", buf[:n])
 				}
-				if !c.HeaderWritten() {
-					c.Status(500).String(500, "Internal Server Error")
+				panicErr := fmt.Errorf("panic: %v", err)
+				if c.HeaderWritten() {
+					c.Errors = append(c.Errors, panicErr)
+				} else {
+					// Rendered as a 500 by the engine's error handler
+					c.HandleError(panicErr)
 				}
 			}
 		}()
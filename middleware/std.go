@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	stdContext "context"
+	"net/http"
+
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// stdContextKey carries the KVolt context through a standard middleware.
+type stdContextKey struct{}
+
+// FromStd adapts standard net/http middleware (func(http.Handler) http.Handler)
+// into a KVolt middleware. The rest of the chain runs when the wrapped
+// middleware calls its next handler, using the http.ResponseWriter and
+// *http.Request it passes on. If it never calls next, the chain stops there.
+//
+//	app.Use(middleware.FromStd(otelhttp.NewMiddleware("api")))
+func FromStd(mw func(http.Handler) http.Handler) func(c *context.Context) error {
+	// Build the wrapped handler once; the current Context travels in the request
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := r.Context().Value(stdContextKey{}).(*context.Context)
+		origWriter, origRequest := c.Writer, c.Request
+		c.Writer, c.Request = context.NewResponseWriter(w), r
+
+		c.Next()
+
+		// Outer middleware should see the writer and request they passed in
+		c.Writer, c.Request = origWriter, origRequest
+	}))
+
+	return func(c *context.Context) error {
+		r := c.Request.WithContext(stdContext.WithValue(c.Request.Context(), stdContextKey{}, c))
+		handler.ServeHTTP(c.Writer, r)
+		return nil
+	}
+}
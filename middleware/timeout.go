@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	stdContext "context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// Timeout returns a middleware that gives the rest of the chain d to
+// respond. The handlers run with a deadline on c (and c.Request.Context())
+// and their response is buffered; when d passes first, they are abandoned
+// (later writes and http.ResponseController calls fail with
+// http.ErrHandlerTimeout) and the chain is aborted
+// with a 503 *context.StatusError, rendered by the error handler.
+//
+//	app.GET("/reports/:id", middleware.Timeout(2*time.Second), showReport)
+//
+// Handlers should stop when c.Done() is closed. Because the response is
+// buffered, do not use Timeout on streaming or WebSocket routes.
+func Timeout(d time.Duration) func(c *context.Context) error {
+	return func(c *context.Context) error {
+		ctx, cancel := stdContext.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		// The handlers get their own Context: an abandoned one keeps running
+		// after this request's Context went back to the pool.
+		tw := &timeoutWriter{
+			rw:     c.Writer,
+			ctx:    ctx,
+			header: c.Writer.Header().Clone(),
+			status: http.StatusOK,
+		}
+		sub := c.Copy() // its Errors start with a copy of c.Errors
+		recorded := len(sub.Errors)
+		sub.Writer = tw
+		sub.Request = c.Request.WithContext(ctx)
+
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+					return
+				}
+				close(done)
+			}()
+			sub.Next()
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p) // let Recovery handle it on the request goroutine
+		case <-done:
+			// A handler that saw the deadline before this select did may
+			// have had writes rejected; its response is incomplete.
+			if tw.copyTo(c.Writer) {
+				c.Errors = append(c.Errors, sub.Errors[recorded:]...)
+				for k, v := range sub.Keys {
+					c.Set(k, v)
+				}
+				if sub.IsAborted() {
+					c.Abort()
+				}
+				return nil
+			}
+		case <-ctx.Done():
+			tw.timeout()
+		}
+
+		c.Abort()
+		if errors.Is(ctx.Err(), stdContext.Canceled) {
+			c.Error(ctx.Err()) // the client went away; nobody reads a response
+			return nil
+		}
+		return &context.StatusError{Status: http.StatusServiceUnavailable, Err: ctx.Err()}
+	}
+}
+
+// timeoutWriter buffers the response of handlers run by Timeout. rw is the
+// request's writer, which goes back to the pool with the request: it is
+// only used under mu, for the http.ResponseController methods, and never
+// once timedOut is set.
+type timeoutWriter struct {
+	rw       http.ResponseWriter
+	ctx      stdContext.Context
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	written  bool
+	timedOut bool
+	before   []func()
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeader(code)
+}
+
+func (w *timeoutWriter) writeHeader(code int) {
+	if w.written || w.expired() {
+		return
+	}
+	for _, fn := range w.before {
+		fn()
+	}
+	w.status = code
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.writeHeader(http.StatusOK)
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+// Flush does nothing: the response is sent when the handlers return.
+func (w *timeoutWriter) Flush() {}
+
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *timeoutWriter) Push(string, *http.PushOptions) error {
+	return http.ErrNotSupported
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+func (w *timeoutWriter) Before(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.before = append(w.before, fn)
+}
+
+// Unwrap returns nil so the request's writer cannot be reached after the
+// deadline; http.ResponseController uses the methods below instead.
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return nil
+}
+
+func (w *timeoutWriter) SetReadDeadline(deadline time.Time) error {
+	return w.control(func(rc *http.ResponseController) error { return rc.SetReadDeadline(deadline) })
+}
+
+func (w *timeoutWriter) SetWriteDeadline(deadline time.Time) error {
+	return w.control(func(rc *http.ResponseController) error { return rc.SetWriteDeadline(deadline) })
+}
+
+func (w *timeoutWriter) EnableFullDuplex() error {
+	return w.control((*http.ResponseController).EnableFullDuplex)
+}
+
+// control runs fn on the request's writer unless the response was given up.
+func (w *timeoutWriter) control(fn func(rc *http.ResponseController) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired() {
+		return http.ErrHandlerTimeout
+	}
+	return fn(http.NewResponseController(w.rw))
+}
+
+// expired reports whether the response was given up, marking it so once
+// the deadline passed. The caller holds w.mu.
+func (w *timeoutWriter) expired() bool {
+	if !w.timedOut && w.ctx.Err() != nil {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+// timeout makes later writes fail.
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+}
+
+// copyTo sends the buffered headers, status and body to dst. It reports
+// false, sending nothing, when a write was rejected after the deadline.
+func (w *timeoutWriter) copyTo(dst http.ResponseWriter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return false
+	}
+	w.timedOut = true // the handlers are done; nothing more is buffered
+	h := dst.Header()
+	clear(h)
+	for k, v := range w.header {
+		h[k] = v
+	}
+	if w.written {
+		dst.WriteHeader(w.status)
+		_, _ = dst.Write(w.buf.Bytes())
+	}
+	return true
+}
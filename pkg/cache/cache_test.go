@@ -23,6 +23,19 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestCache_Close(t *testing.T) {
+	c := NewMemoryStore(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Idempotent and the store stays usable
+	c.Close()
+	c.Set("k", "v", time.Minute)
+	if v, err := c.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get after Close: want v, got %v (err: %v)", v, err)
+	}
+}
+
 func BenchmarkCacheSet(b *testing.B) {
 	c := NewMemoryStore(0)
 	b.RunParallel(func(pb *testing.PB) {
@@ -16,6 +16,8 @@ type item struct {
 // MemoryStore is a blazing fast sharded in-memory cache.
 type MemoryStore struct {
 	shards []*shard
+	stop   chan struct{}
+	once   sync.Once
 }
 
 type shard struct {
@@ -28,6 +30,7 @@ type shard struct {
 func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
 	m := &MemoryStore{
 		shards: make([]*shard, shardCount),
+		stop:   make(chan struct{}),
 	}
 
 	for i := 0; i < shardCount; i++ {
@@ -106,18 +109,35 @@ func (m *MemoryStore) Flush() error {
 	return nil
 }
 
+// Close stops the cleanup goroutine. The store stays usable; expired
+// items are then only detected on Get.
+func (m *MemoryStore) Close() error {
+	m.once.Do(func() { close(m.stop) })
+	return nil
+}
+
 func (m *MemoryStore) janitor(interval time.Duration) {
 	ticker := time.NewTicker(interval)
-	for range ticker.C {
-		now := time.Now().UnixNano()
-		for _, s := range m.shards {
-			s.mu.Lock()
-			for k, v := range s.items {
-				if v.expiresAt > 0 && now > v.expiresAt {
-					delete(s.items, k)
-				}
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.deleteExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *MemoryStore) deleteExpired() {
+	now := time.Now().UnixNano()
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for k, v := range s.items {
+			if v.expiresAt > 0 && now > v.expiresAt {
+				delete(s.items, k)
 			}
-			s.mu.Unlock()
 		}
+		s.mu.Unlock()
 	}
 }
@@ -69,6 +69,7 @@ func (q *MemoryQueue) Start() {
 }
 
 // Stop gracefully shuts down workers.
+// Jobs already buffered are processed before the workers exit.
 func (q *MemoryQueue) Stop() {
 	close(q.quit)
 	q.wg.Wait()
@@ -82,6 +83,19 @@ func (q *MemoryQueue) workerLoop(id int) {
 		case job := <-q.jobChan:
 			q.process(job)
 		case <-q.quit:
+			q.drain()
+			return
+		}
+	}
+}
+
+// drain processes the jobs left in the buffer without blocking.
+func (q *MemoryQueue) drain() {
+	for {
+		select {
+		case job := <-q.jobChan:
+			q.process(job)
+		default:
 			return
 		}
 	}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -67,3 +68,23 @@ func TestMemoryQueue_RegisterAndProcess(t *testing.T) {
 		t.Errorf("want at least 2 jobs processed, got %d", n)
 	}
 }
+
+func TestMemoryQueue_StopDrains(t *testing.T) {
+	q := NewMemoryQueue(10, 1)
+	var processed atomic.Int32
+	q.Register("slow", func(job Job) error {
+		time.Sleep(5 * time.Millisecond)
+		processed.Add(1)
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		if err := q.Push("slow", i); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+	q.Start()
+	q.Stop()
+	if n := processed.Load(); n != 5 {
+		t.Errorf("Stop: want all 5 buffered jobs processed, got %d", n)
+	}
+}
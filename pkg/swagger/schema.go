@@ -0,0 +1,241 @@
+package swagger
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Struct tags that move a request field out of the body (see kvolt.Handle).
+var paramTags = []struct{ tag, in string }{
+	{"uri", "path"},
+	{"query", "query"},
+	{"header", "header"},
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	unsafeName   = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// schemaBuilder converts Go types to OpenAPI schemas, collecting named
+// structs under components/schemas.
+type schemaBuilder struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		schemas: make(map[string]interface{}),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+// schema returns the schema for t; named structs become $refs.
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t, false)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + b.register(t)}
+	}
+	return map[string]interface{}{} // interface{} and anything else: any value
+}
+
+// register adds the named struct t to components and returns its name.
+func (b *schemaBuilder) register(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := unsafeName.ReplaceAllString(t.Name(), "_")
+	if _, taken := b.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = unsafeName.ReplaceAllString(pkg[strings.LastIndex(pkg, "/")+1:], "_") + "." + name
+	}
+	b.names[t] = name
+	b.schemas[name] = map[string]interface{}{} // placeholder for recursive types
+	b.schemas[name] = b.object(t, false)
+	return name
+}
+
+// object builds an object schema from the exported fields of struct t.
+// With bodyOnly, fields bound from path, query or headers are left out.
+func (b *schemaBuilder) object(t reflect.Type, bodyOnly bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	b.fields(t, bodyOnly, properties, &required)
+
+	obj := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, bodyOnly bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if bodyOnly {
+			if _, ok := paramSource(field); ok {
+				continue
+			}
+		}
+		name, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			b.fields(ft, bodyOnly, properties, required)
+			continue
+		}
+		properties[name] = b.schema(field.Type)
+		if isRequired(field) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// params returns the path, query and header parameters declared by the
+// tagged fields of request type t.
+func (b *schemaBuilder) params(t reflect.Type) []map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var out []map[string]interface{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct {
+			out = append(out, b.params(ft)...)
+			continue
+		}
+		p, ok := paramSource(field)
+		if !ok {
+			continue
+		}
+		out = append(out, map[string]interface{}{
+			"name":     p.name,
+			"in":       p.in,
+			"required": p.in == "path" || isRequired(field),
+			"schema":   b.schema(field.Type),
+		})
+	}
+	return out
+}
+
+// hasBody reports whether request type t has any fields read from the body.
+func hasBody(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if _, skip := jsonName(field); skip {
+			continue
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			if hasBody(ft) {
+				return true
+			}
+			continue
+		}
+		if _, ok := paramSource(field); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+type paramRef struct{ name, in string }
+
+func paramSource(field reflect.StructField) (paramRef, bool) {
+	for _, p := range paramTags {
+		if name := field.Tag.Get(p.tag); name != "" && name != "-" {
+			return paramRef{name: name, in: p.in}, true
+		}
+	}
+	return paramRef{}, false
+}
+
+// jsonName returns the JSON property name of field, or skip for `json:"-"`.
+func jsonName(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+func isRequired(field reflect.StructField) bool {
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,16 @@
 package swagger
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/go-kvolt/kvolt"
 	"github.com/go-kvolt/kvolt/context"
+	"github.com/go-kvolt/kvolt/router"
 	"github.com/swaggo/swag"
 )
 
@@ -30,9 +34,12 @@ func (a *kvoltAdapter) Routes() []RouteInfo {
 	var routes []RouteInfo
 	for _, r := range kvoltRoutes {
 		routes = append(routes, RouteInfo{
-			Method:  r.Method,
-			Path:    r.Path,
-			Summary: r.Summary,
+			Method:   r.Method,
+			Path:     r.Path,
+			Host:     r.Host,
+			Summary:  r.Summary,
+			Request:  r.Request,
+			Response: r.Response,
 		})
 	}
 	return routes
@@ -75,7 +82,11 @@ type Config struct {
 type RouteInfo struct {
 	Method  string
 	Path    string
+	Host    string // kvolt.Engine.Host pattern, if any
 	Summary string
+	// Request and Response are the types of a route registered with kvolt.Typed.
+	// When set, the spec includes their schemas.
+	Request, Response reflect.Type
 }
 
 // Handler returns a KVolt handler that serves the Swagger UI and the spec.
@@ -111,10 +122,9 @@ func Handler(cfg Config) func(c *context.Context) error {
 
 		// 1. Serve the Spec JSON
 		if strings.HasSuffix(path, "doc.json") {
-			c.Writer.Header().Set("Content-Type", "application/json")
-			c.Writer.WriteHeader(200)
-
 			if len(cfg.SpecJSON) > 0 {
+				c.Writer.Header().Set("Content-Type", "application/json")
+				c.Writer.WriteHeader(200)
 				_, err := c.Writer.Write([]byte(cfg.SpecJSON))
 				return err
 			}
@@ -122,10 +132,16 @@ func Handler(cfg Config) func(c *context.Context) error {
 			// Generate if not provided
 			if len(cachedSpec) == 0 && cfg.RoutesProvider != nil {
 				routes := cfg.RoutesProvider.Routes()
-				cachedSpec = generateOpenAPI(routes, cfg.Title)
+				spec, err := generateOpenAPI(routes, cfg.Title)
+				if err != nil {
+					return err
+				}
+				cachedSpec = spec
 			}
 
 			if len(cachedSpec) > 0 {
+				c.Writer.Header().Set("Content-Type", "application/json")
+				c.Writer.WriteHeader(200)
 				_, err := c.Writer.Write(cachedSpec)
 				return err
 			}
@@ -141,57 +157,118 @@ func Handler(cfg Config) func(c *context.Context) error {
 	}
 }
 
-func generateOpenAPI(routes []RouteInfo, title string) []byte {
-	paths := make(map[string]map[string]interface{})
+// operation is one OpenAPI operation and the hosts it is served on; ""
+// stands for routes without a host.
+type operation struct {
+	path, method string // OpenAPI path and lower-case method
+	spec         map[string]interface{}
+	key          []byte // spec encoded, to compare registrations
+	hosts        []string
+}
 
-	for _, r := range routes {
-		if r.Path == "" {
+// generateOpenAPI builds the spec for routes. A path and method registered
+// on several hosts (or on a host and the engine itself) with the same
+// operation is documented once, listing every host under servers. Hosts
+// that serve a different operation get their own path item, keyed by the
+// path plus a "#host" fragment, which clients drop from request URLs.
+func generateOpenAPI(routes []RouteInfo, title string) ([]byte, error) {
+	var operations []*operation
+	variants := make(map[string][]*operation) // by method and OpenAPI path
+	schemas := newSchemaBuilder()
+
+	for _, route := range routes {
+		if route.Path == "" {
 			continue
 		}
+		// An optional param documents two paths: with and without it
+		patterns, err := router.Expand(route.Path)
+		if err != nil {
+			patterns = []string{route.Path}
+		}
+		for _, pattern := range patterns {
+			r := route
+			r.Path = pattern
+
+			// Parse parameters from path (e.g. /users/:id<int> -> {id} and add to param list)
+			openAPIPath, parameters := pathParameters(r.Path)
+
+			method := strings.ToLower(r.Method)
+			summary := r.Summary
+			if summary == "" {
+				summary = fmt.Sprintf("%s %s", r.Method, r.Path)
+			}
 
-		// Parse parameters from path (e.g. /users/:id -> {id} and add to param list)
-		var parameters []map[string]interface{}
-		segments := strings.Split(r.Path, "/")
-		for i, seg := range segments {
-			if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
-				paramName := seg[1:]
-				segments[i] = "{" + paramName + "}"
-
-				// Create parameter definition
-				parameters = append(parameters, map[string]interface{}{
-					"name":     paramName,
-					"in":       "path",
-					"required": true,
-					"schema": map[string]string{
-						"type": "string", // Default to string for auto-generated
+			spec := map[string]interface{}{
+				"summary": summary,
+				"responses": map[string]interface{}{
+					"200": map[string]string{"description": "OK"},
+				},
+			}
+
+			if r.Request != nil {
+				parameters = mergeParameters(parameters, schemas.params(r.Request))
+				if hasBody(r.Request) {
+					spec["requestBody"] = map[string]interface{}{
+						"required": true,
+						"content":  jsonContent(bodySchema(schemas, r.Request)),
+					}
+				}
+			}
+			if r.Response != nil {
+				spec["responses"] = map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "OK",
+						"content":     jsonContent(schemas.schema(r.Response)),
 					},
-				})
+				}
 			}
-		}
-		openAPIPath := strings.Join(segments, "/")
 
-		if paths[openAPIPath] == nil {
-			paths[openAPIPath] = make(map[string]interface{})
-		}
+			if len(parameters) > 0 {
+				spec["parameters"] = parameters
+			}
 
-		method := strings.ToLower(r.Method)
-		summary := r.Summary
-		if summary == "" {
-			summary = fmt.Sprintf("%s %s", r.Method, r.Path)
+			key, _ := json.Marshal(spec)
+			var op *operation
+			for _, v := range variants[method+" "+openAPIPath] {
+				if bytes.Equal(v.key, key) {
+					op = v
+					break
+				}
+			}
+			if op == nil {
+				op = &operation{path: openAPIPath, method: method, spec: spec, key: key}
+				variants[method+" "+openAPIPath] = append(variants[method+" "+openAPIPath], op)
+				operations = append(operations, op)
+			}
+			if !slices.Contains(op.hosts, r.Host) {
+				op.hosts = append(op.hosts, r.Host)
+			}
 		}
+	}
 
-		operation := map[string]interface{}{
-			"summary": summary,
-			"responses": map[string]interface{}{
-				"200": map[string]string{"description": "OK"},
-			},
+	paths := make(map[string]map[string]interface{})
+	for _, op := range operations {
+		path := op.path
+		if len(variants[op.method+" "+op.path]) > 1 && !slices.Contains(op.hosts, "") {
+			path += "#" + op.hosts[0]
 		}
-
-		if len(parameters) > 0 {
-			operation["parameters"] = parameters
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
 		}
+		paths[path][op.method] = op.spec
 
-		paths[openAPIPath][method] = operation
+		if len(op.hosts) == 1 && op.hosts[0] == "" {
+			continue
+		}
+		servers := make([]interface{}, len(op.hosts))
+		for i, host := range op.hosts {
+			if host == "" {
+				servers[i] = map[string]interface{}{"url": "/"}
+				continue
+			}
+			servers[i] = hostServer(host)
+		}
+		op.spec["servers"] = servers
 	}
 
 	spec := map[string]interface{}{
@@ -202,9 +279,118 @@ func generateOpenAPI(routes []RouteInfo, title string) []byte {
 		},
 		"paths": paths,
 	}
+	if len(schemas.schemas) > 0 {
+		spec["components"] = map[string]interface{}{"schemas": schemas.schemas}
+	}
+
+	return json.Marshal(spec)
+}
 
-	b, _ := json.Marshal(spec)
-	return b
+// pathParameters converts a route pattern to an OpenAPI path and its path
+// parameters, typed by their constraints.
+func pathParameters(pattern string) (string, []map[string]interface{}) {
+	wildcards, err := router.Wildcards(pattern)
+	if err != nil {
+		return pattern, nil
+	}
+	var (
+		b          strings.Builder
+		parameters []map[string]interface{}
+		pos        int
+	)
+	for _, w := range wildcards {
+		b.WriteString(pattern[pos:w.Start])
+		b.WriteString("{" + w.Name + "}")
+		pos = w.End
+
+		parameters = append(parameters, map[string]interface{}{
+			"name":     w.Name,
+			"in":       "path",
+			"required": true,
+			"schema":   constraintSchema(w.Constraint),
+		})
+	}
+	b.WriteString(pattern[pos:])
+	return b.String(), parameters
+}
+
+// constraintSchema describes the values a path constraint accepts.
+func constraintSchema(c *router.Constraint) map[string]interface{} {
+	if c == nil {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch c.String() {
+	case "int":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case "uint":
+		return map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case "float":
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case "uuid":
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case "alpha":
+		return map[string]interface{}{"type": "string", "pattern": "^[A-Za-z]+$"}
+	case "alnum":
+		return map[string]interface{}{"type": "string", "pattern": "^[A-Za-z0-9]+$"}
+	}
+	return map[string]interface{}{"type": "string", "pattern": "^(?:" + c.String() + ")$"}
+}
+
+// bodySchema describes the body of request type t: its fields minus those
+// bound from the path, query or headers.
+func bodySchema(b *schemaBuilder, t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return b.schema(t)
+	}
+	return b.object(t, true)
+}
+
+// mergeParameters adds typed parameters to the ones parsed from the path,
+// replacing path parameters of the same name.
+func mergeParameters(parsed, typed []map[string]interface{}) []map[string]interface{} {
+	for _, p := range typed {
+		replaced := false
+		for i, existing := range parsed {
+			if existing["name"] == p["name"] && existing["in"] == p["in"] {
+				parsed[i] = p
+				replaced = true
+				break
+			}
+		}
+		// Path params exist only where the pattern declares them
+		if !replaced && p["in"] != "path" {
+			parsed = append(parsed, p)
+		}
+	}
+	return parsed
+}
+
+// hostServer describes a host pattern as an OpenAPI server; ":name" labels
+// become server variables.
+func hostServer(pattern string) map[string]interface{} {
+	labels := strings.Split(pattern, ".")
+	variables := make(map[string]interface{})
+	for i, label := range labels {
+		if strings.HasPrefix(label, ":") {
+			name := label[1:]
+			labels[i] = "{" + name + "}"
+			variables[name] = map[string]string{"default": name}
+		}
+	}
+	server := map[string]interface{}{"url": "//" + strings.Join(labels, ".")}
+	if len(variables) > 0 {
+		server["variables"] = variables
+	}
+	return server
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
 }
 
 const uiTemplate = `<!doctype html>
@@ -1,10 +1,13 @@
 package swagger
 
 import (
+	"encoding/json"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/go-kvolt/kvolt"
 	"github.com/go-kvolt/kvolt/context"
 	"github.com/go-kvolt/kvolt/router"
 )
@@ -59,3 +62,169 @@ func TestHandler_IndexHTML(t *testing.T) {
 		t.Errorf("index.html: body should contain title")
 	}
 }
+
+type address struct {
+	City string `json:"city"`
+}
+
+type createUser struct {
+	Org   string   `uri:"org"`
+	Trace string   `header:"X-Trace-Id"`
+	Name  string   `json:"name" validate:"required"`
+	Tags  []string `json:"tags,omitempty"`
+	Home  *address `json:"home"`
+}
+
+type user struct {
+	ID   int64   `json:"id"`
+	Name string  `json:"name"`
+	Home address `json:"home"`
+}
+
+func TestGenerateOpenAPI_TypedRoutes(t *testing.T) {
+	spec := mustGenerate(t, []RouteInfo{{
+		Method:   "POST",
+		Path:     "/orgs/:org/users",
+		Request:  reflect.TypeOf(createUser{}),
+		Response: reflect.TypeOf(user{}),
+	}})
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name   string
+				In     string
+				Schema map[string]interface{}
+			}
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]interface{}
+				}
+			}
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema map[string]interface{}
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	op := doc.Paths["/orgs/{org}/users"]["post"]
+	if len(op.Parameters) != 2 || op.Parameters[1].In != "header" {
+		t.Errorf("parameters: want path org and header X-Trace-Id, got %+v", op.Parameters)
+	}
+
+	body := op.RequestBody.Content["application/json"].Schema
+	props, _ := body["properties"].(map[string]interface{})
+	if _, ok := props["org"]; ok || props["name"] == nil || props["tags"] == nil {
+		t.Errorf("request body: want name and tags only, got %v", props)
+	}
+	if req, _ := body["required"].([]interface{}); len(req) != 1 || req[0] != "name" {
+		t.Errorf("request body: want name required, got %v", body["required"])
+	}
+
+	resp := op.Responses["200"].Content["application/json"].Schema
+	if resp["$ref"] != "#/components/schemas/user" {
+		t.Errorf("response: want $ref to user, got %v", resp)
+	}
+	if doc.Components.Schemas["user"] == nil || doc.Components.Schemas["address"] == nil {
+		t.Errorf("components: want user and address, got %v", doc.Components.Schemas)
+	}
+}
+
+func TestGenerateOpenAPI_Host(t *testing.T) {
+	spec := string(mustGenerate(t, []RouteInfo{
+		{Method: "GET", Path: "/users", Host: ":tenant.example.com"},
+	}))
+	if !strings.Contains(spec, `"url":"//{tenant}.example.com"`) || !strings.Contains(spec, `"default":"tenant"`) {
+		t.Errorf("servers: want templated host, got %s", spec)
+	}
+}
+
+func TestGenerateOpenAPI_SamePathOnSeveralHosts(t *testing.T) {
+	app := kvolt.New()
+	list := func(c *context.Context) error { return nil }
+	app.Host("api.example.com").GET("/users", list)
+	app.GET("/users", list)
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Servers []struct{ URL string } `json:"servers"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(mustGenerate(t, Adapter(app).Routes()), &doc); err != nil {
+		t.Fatal(err)
+	}
+	servers := doc.Paths["/users"]["get"].Servers
+	if len(servers) != 2 || servers[0].URL != "//api.example.com" || servers[1].URL != "/" {
+		t.Errorf("GET /users: want servers //api.example.com and /, got %+v", servers)
+	}
+
+}
+
+func TestGenerateOpenAPI_DifferentOperationsPerHost(t *testing.T) {
+	app := kvolt.New()
+	h := func(c *context.Context) error { return nil }
+	app.GET("/", h).Desc("Marketing home")
+	app.Host("api.example.com").GET("/", h).Desc("API index")
+	app.Host("admin.example.com").GET("/", h).Desc("Admin index")
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Summary string
+			Servers []struct{ URL string } `json:"servers"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(mustGenerate(t, Adapter(app).Routes()), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]struct{ summary, server string }{
+		"/":                   {"Marketing home", ""},
+		"/#api.example.com":   {"API index", "//api.example.com"},
+		"/#admin.example.com": {"Admin index", "//admin.example.com"},
+	} {
+		op := doc.Paths[path]["get"]
+		if op.Summary != want.summary || (want.server == "") != (len(op.Servers) == 0) ||
+			(want.server != "" && op.Servers[0].URL != want.server) {
+			t.Errorf("%s: want %q on %q, got %+v", path, want.summary, want.server, op)
+		}
+	}
+}
+
+func TestGenerateOpenAPI_Constraints(t *testing.T) {
+	spec := string(mustGenerate(t, []RouteInfo{
+		{Method: "GET", Path: "/users/:id<int>/files/:name<[a-z]+>"},
+	}))
+	for _, want := range []string{
+		`"/users/{id}/files/{name}"`,
+		`"format":"int64","type":"integer"`,
+		`"pattern":"^(?:[a-z]+)$"`,
+	} {
+		if !strings.Contains(spec, want) {
+			t.Errorf("spec: want %s, got %s", want, spec)
+		}
+	}
+}
+
+func TestGenerateOpenAPI_OptionalParam(t *testing.T) {
+	spec := string(mustGenerate(t, []RouteInfo{
+		{Method: "GET", Path: "/posts/:page<int>?"},
+	}))
+	if !strings.Contains(spec, `"/posts":{`) || !strings.Contains(spec, `"/posts/{page}":{`) {
+		t.Errorf("optional param: want /posts and /posts/{page}, got %s", spec)
+	}
+}
+
+func mustGenerate(t *testing.T, routes []RouteInfo) []byte {
+	t.Helper()
+	spec, err := generateOpenAPI(routes, "Test")
+	if err != nil {
+		t.Fatalf("generateOpenAPI: %v", err)
+	}
+	return spec
+}
@@ -0,0 +1,194 @@
+//go:build !windows
+
+package kvolt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Environment passed from a restarting parent to its child.
+const (
+	// envListeners lists the configured addresses of the inherited sockets,
+	// comma-separated, in file descriptor order starting at listenFDStart.
+	envListeners = "KVOLT_LISTENERS"
+	// envReadyFD is the descriptor the child writes to once it is serving.
+	envReadyFD = "KVOLT_READY_FD"
+
+	// listenFDStart is the first inherited descriptor (after stdin/out/err),
+	// both for exec.Cmd.ExtraFiles and systemd socket activation.
+	listenFDStart = 3
+)
+
+var defaultRestartSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// inheritedListeners returns sockets passed by a restarting parent, keyed by
+// configured address, and sockets passed by systemd (LISTEN_FDS), in order.
+func inheritedListeners() (map[string]net.Listener, []net.Listener, error) {
+	if v := os.Getenv(envListeners); v != "" {
+		os.Unsetenv(envListeners)
+		keyed := make(map[string]net.Listener)
+		for i, addr := range strings.Split(v, ",") {
+			ln, err := fileListener(listenFDStart+i, addr)
+			if err != nil {
+				return nil, nil, err
+			}
+			keyed[addr] = ln
+		}
+		return keyed, nil, nil
+	}
+
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	activated := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		ln, err := fileListener(listenFDStart+i, "LISTEN_FD_"+strconv.Itoa(listenFDStart+i))
+		if err != nil {
+			return nil, nil, err
+		}
+		activated = append(activated, ln)
+	}
+	return nil, activated, nil
+}
+
+// fileListener wraps an inherited descriptor. net.FileListener dups it, so
+// the original is closed.
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("kvolt: invalid inherited descriptor %d (%s)", fd, name)
+	}
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("kvolt: inherited descriptor %d (%s): %w", fd, name, err)
+	}
+	return ln, nil
+}
+
+// notifyParentReady tells a restarting parent that this process is serving.
+func notifyParentReady() error {
+	v := os.Getenv(envReadyFD)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(envReadyFD)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("kvolt: invalid %s: %w", envReadyFD, err)
+	}
+	f := os.NewFile(uintptr(fd), "kvolt-ready")
+	if f == nil {
+		return fmt.Errorf("kvolt: invalid %s descriptor %d", envReadyFD, fd)
+	}
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// restart execs a new copy of the binary with the configured sockets and
+// waits until it reports ready. On error the child is killed and the
+// caller keeps serving.
+func (e *Engine) restart(cfg *ServerConfig, listeners []listener) error {
+	var (
+		files []*os.File
+		addrs []string
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		if l.addr == "" {
+			continue // owned by the caller (ServerConfig.Listener)
+		}
+		fl, ok := l.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		addrs = append(addrs, l.addr)
+	}
+	if len(files) == 0 {
+		return errors.New("kvolt: no listeners to hand over")
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(restartEnv(os.Environ()),
+		envListeners+"="+strings.Join(addrs, ","),
+		envReadyFD+"="+strconv.Itoa(listenFDStart+len(files)),
+	)
+	err = cmd.Start()
+	readyW.Close() // only the child holds the write end now
+	if err != nil {
+		return err
+	}
+	cfg.Logger.Printf("🔄 Restarting: handed %d listener(s) to pid %d", len(files), cmd.Process.Pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		// EOF means the child exited (or closed the pipe) without signaling
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err == nil {
+			return cmd.Process.Release()
+		}
+		err = fmt.Errorf("kvolt: new process exited before becoming ready: %w", err)
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	case <-time.After(cfg.RestartTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("kvolt: new process not ready after %v", cfg.RestartTimeout)
+	}
+}
+
+// restartEnv drops inherited-socket variables so they are not passed on stale.
+func restartEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case envListeners, envReadyFD, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+//go:build !windows
+
+package kvolt
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/go-kvolt/kvolt/context"
+)
+
+// TestRestartChildHelper is the "new process" of TestEngine_InheritListener.
+func TestRestartChildHelper(t *testing.T) {
+	addr := os.Getenv("KVOLT_TEST_CHILD_ADDR")
+	if addr == "" {
+		t.Skip("helper process")
+	}
+	app := New()
+	app.GET("/who", func(c *context.Context) error { return c.String(200, "child") })
+	app.Server(ServerConfig{Addr: addr, Logger: log.New(io.Discard, "", 0)})
+}
+
+func TestEngine_InheritListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestartChildHelper$")
+	cmd.ExtraFiles = []*os.File{f, readyW}
+	cmd.Env = append(restartEnv(os.Environ()),
+		"KVOLT_TEST_CHILD_ADDR="+addr,
+		envListeners+"="+addr,
+		envReadyFD+"=4",
+	)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	readyW.Close()
+	f.Close()
+	// The parent stops accepting; only the child serves the shared socket now
+	ln.Close()
+
+	readyR.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := readyR.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("child did not report ready: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/who")
+	if err != nil {
+		t.Fatalf("GET via inherited socket: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "child" {
+		t.Errorf("GET via inherited socket: want child, got %q", body)
+	}
+}
+
+func TestRestartEnv(t *testing.T) {
+	env := restartEnv([]string{"PATH=/bin", envListeners + "=:8080", "LISTEN_FDS=2", envReadyFD + "=4"})
+	if len(env) != 1 || env[0] != "PATH=/bin" {
+		t.Errorf("restartEnv: want only PATH, got %v", env)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package kvolt
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+var defaultRestartSignals []os.Signal
+
+// inheritedListeners is a no-op: descriptor passing is not supported on Windows.
+func inheritedListeners() (map[string]net.Listener, []net.Listener, error) {
+	return nil, nil, nil
+}
+
+func notifyParentReady() error {
+	return nil
+}
+
+func (e *Engine) restart(cfg *ServerConfig, listeners []listener) error {
+	return errors.New("kvolt: graceful restart is not supported on windows")
+}
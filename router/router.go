@@ -1,68 +1,310 @@
 package router
 
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
 // Router registers routes to be matched and dispatches a handler.
+//
+// Routes may be added, removed and replaced while requests are served:
+// changes are made to a copy of the affected tree, sharing the untouched
+// branches, which is then swapped in atomically. Lookups never lock.
 type Router struct {
-	trees map[string]*Node
-	docs  map[string]string // Key: "METHOD /path", Value: "Description"
+	mu    sync.Mutex            // serializes changes
+	trees atomic.Pointer[trees] // read-only once published
+	docs  map[string]string     // Key: "METHOD /path", Value: "Description"; guarded by mu
 }
 
 // New creates a new Router.
 func New() *Router {
-	return &Router{
-		trees: make(map[string]*Node),
-		docs:  make(map[string]string),
+	r := &Router{docs: make(map[string]string)}
+	r.trees.Store(&trees{})
+	return r
+}
+
+// standardMethods are the methods with a slot in trees.std.
+var standardMethods = [...]string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace,
+}
+
+// methodIndex returns the slot of a standard method, or -1.
+func methodIndex(method string) int {
+	switch method {
+	case http.MethodGet:
+		return 0
+	case http.MethodHead:
+		return 1
+	case http.MethodPost:
+		return 2
+	case http.MethodPut:
+		return 3
+	case http.MethodPatch:
+		return 4
+	case http.MethodDelete:
+		return 5
+	case http.MethodOptions:
+		return 6
+	case http.MethodConnect:
+		return 7
+	case http.MethodTrace:
+		return 8
 	}
+	return -1
+}
+
+// trees is a published set of method trees. Standard methods are indexed
+// in an array, so the common lookup costs no map access.
+type trees struct {
+	std    [len(standardMethods)]*Node
+	custom map[string]*Node // other methods
+	// maxParams is the most params any route has captured; it never shrinks
+	maxParams int
+}
+
+func (t *trees) get(method string) *Node {
+	if i := methodIndex(method); i >= 0 {
+		return t.std[i]
+	}
+	return t.custom[method]
+}
+
+// with returns a copy of t with root as the tree for method; nil removes it.
+func (t *trees) with(method string, root *Node) *trees {
+	next := &trees{std: t.std, maxParams: t.maxParams}
+	if i := methodIndex(method); i >= 0 {
+		next.std[i] = root
+		next.custom = t.custom
+		return next
+	}
+	next.custom = make(map[string]*Node, len(t.custom)+1)
+	for m, n := range t.custom {
+		next.custom[m] = n
+	}
+	if root != nil {
+		next.custom[method] = root
+	} else {
+		delete(next.custom, method)
+	}
+	return next
+}
+
+// each calls fn for every method that has a tree.
+func (t *trees) each(fn func(method string, root *Node)) {
+	for i, root := range t.std {
+		if root != nil {
+			fn(standardMethods[i], root)
+		}
+	}
+	for method, root := range t.custom {
+		fn(method, root)
+	}
+}
+
+// tree returns the published tree for method, or nil.
+func (r *Router) tree(method string) *Node {
+	return r.trees.Load().get(method)
+}
+
+// publish swaps in root as the tree for method; nil removes it. params is
+// the number of params of a route just added. The caller holds r.mu.
+func (r *Router) publish(method string, root *Node, params int) {
+	next := r.trees.Load().with(method, root)
+	next.maxParams = max(next.maxParams, params)
+	r.trees.Store(next)
+}
+
+// MaxParams returns the most params a lookup can return, counting every
+// route ever added. Params with this capacity never grow during a lookup.
+func (r *Router) MaxParams() int {
+	return r.trees.Load().maxParams
 }
 
 // AddRoute registers a new request handler with the given path and method.
+// It panics if the path is invalid or conflicts with a registered route.
 func (r *Router) AddRoute(method, path string, handle Handler) {
-	root := r.trees[method]
-	if root == nil {
-		root = &Node{}
-		r.trees[method] = root
+	if err := r.Insert(method, path, handle); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Insert is AddRoute returning an error instead of panicking. A conflict
+// with a registered route is a *ConflictError. On error the router is
+// left unchanged.
+func (r *Router) Insert(method, path string, handle Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	root := &Node{}
+	if t := r.tree(method); t != nil {
+		root = t.clone()
 	}
-	root.insert(path, handle)
+	if err := root.insert(path, handle); err != nil {
+		return err
+	}
+	wildcards, _ := Wildcards(path)
+	r.publish(method, root, len(wildcards))
+	return nil
+}
+
+// Remove unregisters the route added with exactly this method and path
+// (param names and constraints included) and returns its handler, or nil
+// if there is none. Its documentation is removed as well.
+func (r *Router) Remove(method, path string) Handler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.tree(method)
+	if t == nil {
+		return nil
+	}
+	root := t.clone()
+	handle := root.remove(path)
+	if handle == nil {
+		return nil
+	}
+	if root.priority == 0 {
+		root = nil
+	}
+	r.publish(method, root, 0)
+	delete(r.docs, method+" "+path)
+	return handle
+}
+
+// Replace swaps the handler of the route added with exactly this method and
+// path and returns the previous one. It returns nil, changing nothing, if
+// there is no such route.
+func (r *Router) Replace(method, path string, handle Handler) Handler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.tree(method)
+	if t == nil {
+		return nil
+	}
+	root := t.clone()
+	old := root.remove(path)
+	if old == nil {
+		return nil
+	}
+	if err := root.insert(path, handle); err != nil {
+		return nil // unreachable: the pattern was just removed
+	}
+	r.publish(method, root, 0)
+	return old
 }
 
 // Find lookup a handler given a method and path.
 func (r *Router) Find(method, path string) (Handler, Params, bool) {
-	root := r.trees[method]
+	handle, ps, _ := r.Lookup(method, path)
+	return handle, ps, handle != nil
+}
+
+// Lookup is like Find but, when no route matches, reports whether one
+// would with a trailing slash added or removed (tsr).
+func (r *Router) Lookup(method, path string) (handle Handler, ps Params, tsr bool) {
+	handle, tsr = r.Match(method, path, &ps)
+	return handle, ps, tsr
+}
+
+// Match is Lookup appending the params to *ps, so the caller can reuse one
+// slice across requests. When cap(*ps) is at least MaxParams, Match does
+// not allocate. On a miss *ps is left as it was.
+func (r *Router) Match(method, path string, ps *Params) (handle Handler, tsr bool) {
+	root := r.tree(method)
+	if root == nil {
+		return nil, false
+	}
+	return root.getValue(path, ps)
+}
+
+// FixedPath returns the registered spelling of path for method, matching
+// static segments case-insensitively and, with fixTrailingSlash, adding or
+// removing a trailing slash. Use it to redirect to the canonical URL.
+func (r *Router) FixedPath(method, path string, fixTrailingSlash bool) (string, bool) {
+	root := r.tree(method)
 	if root == nil {
-		return nil, nil, false
+		return "", false
+	}
+	return root.findCaseInsensitive(path, fixTrailingSlash)
+}
+
+// CleanPath returns the canonical form of p: rooted, with duplicate
+// slashes and "." and ".." elements removed. A trailing slash is kept.
+func CleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Allowed returns the comma-separated list of methods that can serve path,
+// suitable for an Allow header. HEAD is implied by GET and OPTIONS is always
+// included. An empty string means no method matches the path at all.
+func (r *Router) Allowed(path string) string {
+	var allowed []string
+	var ps Params
+	r.trees.Load().each(func(method string, root *Node) {
+		if method == http.MethodOptions {
+			return
+		}
+		if handle, _ := root.getValue(path, &ps); handle != nil {
+			allowed = append(allowed, method)
+		}
+		ps = ps[:0]
+	})
+	if len(allowed) == 0 {
+		// An explicit OPTIONS route alone is not worth advertising
+		return ""
+	}
+
+	hasHead := false
+	hasGet := false
+	for _, method := range allowed {
+		switch method {
+		case http.MethodHead:
+			hasHead = true
+		case http.MethodGet:
+			hasGet = true
+		}
 	}
-	handle, ps, _ := root.getValue(path)
-	if handle != nil {
-		return handle, ps, true
+	if hasGet && !hasHead {
+		allowed = append(allowed, http.MethodHead)
 	}
-	return nil, nil, false
+	allowed = append(allowed, http.MethodOptions)
+
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
 }
 
 // SetDocumentation adds a description for a registered route.
 func (r *Router) SetDocumentation(method, path, desc string) {
-	key := method + " " + path
-	r.docs[key] = desc
+	r.mu.Lock()
+	r.docs[method+" "+path] = desc
+	r.mu.Unlock()
+}
+
+// Documentation returns the description set for a route, or "".
+func (r *Router) Documentation(method, path string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.docs[method+" "+path]
 }
 
 // Walk iterates over all registered routes.
 // The callback function is called for each route with the method, full path, and description.
 func (r *Router) Walk(walkFunc func(method, path, desc string)) {
-	for method, root := range r.trees {
+	r.trees.Load().each(func(method string, root *Node) {
 		root.walk(pathStub, func(path string) {
-			key := method + " " + path
-			desc := r.docs[key]
-			walkFunc(method, path, desc)
+			walkFunc(method, path, r.Documentation(method, path))
 		})
-	}
+	})
 }
 
 const pathStub = ""
-
-func (n *Node) walk(path string, walkFunc func(path string)) {
-	fullPath := path + n.path
-	if n.handle != nil {
-		walkFunc(fullPath)
-	}
-	for _, child := range n.children {
-		child.walk(fullPath, walkFunc)
-	}
-}
@@ -1,7 +1,10 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -35,3 +38,384 @@ func TestRouter_Basic(t *testing.T) {
 	r.AddRoute("GET", "/users/:id", func(c any) error { return nil })
 	// Not testing param logic yet, just static matching of /ping vs /
 }
+
+func TestRouter_ParamsBeforeStatic(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/orgs/:org/items/:id", "item")
+
+	h, ps, found := r.Find("GET", "/orgs/acme/items/7")
+	if !found || h != "item" {
+		t.Fatalf("Find: want item, got %v %v", h, found)
+	}
+	if ps.Get("org") != "acme" || ps.Get("id") != "7" {
+		t.Errorf("Params: want org=acme id=7, got %v", ps)
+	}
+}
+
+func TestRouter_Allowed(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/users/:id", func(c any) error { return nil })
+	r.AddRoute("PUT", "/users/:id", func(c any) error { return nil })
+	r.AddRoute("OPTIONS", "/only-options", func(c any) error { return nil })
+
+	if got := r.Allowed("/users/7"); got != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Allowed: want %q, got %q", "GET, HEAD, OPTIONS, PUT", got)
+	}
+	if got := r.Allowed("/missing"); got != "" {
+		t.Errorf("Allowed missing: want empty, got %q", got)
+	}
+	if got := r.Allowed("/only-options"); got != "" {
+		t.Errorf("Allowed options-only: want empty, got %q", got)
+	}
+}
+
+func TestRouter_Constraints(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/users/:id<int>", "byID")
+	r.AddRoute("GET", "/users/:key<uuid>", "byUUID")
+	r.AddRoute("GET", "/users/:name", "byName")
+	r.AddRoute("GET", "/users/me", "me")
+	r.AddRoute("GET", "/posts/:slug<[a-z]+(?P<n>-[0-9]+)?>/comments", "comments")
+	r.AddRoute("GET", "/posts/:any/comments", "anyComments")
+
+	cases := []struct {
+		path, want, key, value string
+	}{
+		{"/users/42", "byID", "id", "42"},
+		{"/users/-7", "byID", "id", "-7"},
+		{"/users/0f8fad5b-d9cb-469f-a165-70867728950e", "byUUID", "key", "0f8fad5b-d9cb-469f-a165-70867728950e"},
+		{"/users/bob", "byName", "name", "bob"},
+		{"/users/me", "me", "", ""},
+		{"/posts/hello-2/comments", "comments", "slug", "hello-2"},
+		{"/posts/Hello/comments", "anyComments", "any", "Hello"}, // regex fails, falls through
+	}
+	for _, tc := range cases {
+		h, ps, found := r.Find("GET", tc.path)
+		if !found || h != tc.want {
+			t.Errorf("%s: want %s, got %v", tc.path, tc.want, h)
+			continue
+		}
+		if tc.key != "" && (len(ps) != 1 || ps.Get(tc.key) != tc.value) {
+			t.Errorf("%s: want %s=%s, got %v", tc.path, tc.key, tc.value, ps)
+		}
+	}
+
+	var walked []string
+	r.Walk(func(method, path, desc string) { walked = append(walked, path) })
+	sort.Strings(walked)
+	if want := "/posts/:any/comments /posts/:slug<[a-z]+(?P<n>-[0-9]+)?>/comments /users/:id<int> /users/:key<uuid> /users/:name /users/me"; strings.Join(walked, " ") != want {
+		t.Errorf("Walk: want %s, got %v", want, walked)
+	}
+}
+
+func TestRouter_ConstraintBacktracking(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/a/:x<int>/edit", "intEdit")
+	r.AddRoute("GET", "/a/:y/view", "view")
+
+	// The int branch matches the segment but not the rest: params are unwound
+	h, ps, found := r.Find("GET", "/a/1/view")
+	if !found || h != "view" || len(ps) != 1 || ps.Get("y") != "1" {
+		t.Errorf("backtrack: want view y=1, got %v %v", h, ps)
+	}
+	if _, _, found := r.Find("GET", "/a/x/edit"); found {
+		t.Error("constraint: /a/x/edit should not match")
+	}
+}
+
+func TestRouter_InvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"/a/:id<[0-9+>", // unterminated
+		"/a/:id<(>",     // bad regex
+		"/a/:x?/b",      // optional param not last
+		"/a/v:x?",       // optional param not a whole segment
+		"/a/*rest<int>", // constrained catch-all
+		"/a/*rest/more", // catch-all not last
+		"/a/:",          // unnamed
+		"/a/:x:y",       // adjacent wildcards
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want panic", pattern)
+				}
+			}()
+			New().AddRoute("GET", pattern, "h")
+		}()
+	}
+
+	r := New()
+	r.AddRoute("GET", "/a/:id", "h")
+	defer func() {
+		if recover() == nil {
+			t.Error("conflicting wildcard names: want panic")
+		}
+	}()
+	r.AddRoute("GET", "/a/:name/x", "h")
+}
+
+func TestRouter_InsertConflict(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/a/:id/b", "first")
+	r.AddRoute("GET", "/posts", "posts")
+
+	r.AddRoute("GET", "/files/*path", "files")
+
+	tests := []struct {
+		path, existing, msg string
+	}{
+		{"/a/:name", "first", "path '/a/:name' conflicts with existing path '/a/:id/b': wildcard ':name' conflicts with ':id'"},
+		{"/a/:id/b", "first", "path '/a/:id/b' conflicts with existing path '/a/:id/b': handlers are already registered"},
+		{"/posts/:page?", "posts", "path '/posts' conflicts with existing path '/posts': handlers are already registered"},
+		{"/files/*name", "files", "path '/files/*name' conflicts with existing path '/files/*path': wildcard '*name' conflicts with '*path'"},
+	}
+	for _, tt := range tests {
+		err := r.Insert("GET", tt.path, "new")
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Errorf("%s: err = %v, want *ConflictError", tt.path, err)
+			continue
+		}
+		if conflict.Existing != tt.existing {
+			t.Errorf("%s: Existing = %v, want %s", tt.path, conflict.Existing, tt.existing)
+		}
+		if err.Error() != tt.msg {
+			t.Errorf("%s: Error() = %q, want %q", tt.path, err.Error(), tt.msg)
+		}
+	}
+
+	// A failed insert leaves the tree untouched
+	if h, _, ok := r.Find("GET", "/posts/2"); ok {
+		t.Errorf("/posts/2 matched %v after failed insert", h)
+	}
+	if err := r.Insert("GET", "/a/:id/c", "c"); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if h, _, _ := r.Find("GET", "/a/1/c"); h != "c" {
+		t.Errorf("/a/1/c = %v, want c", h)
+	}
+}
+
+func TestRouter_TrailingSlashAndFixedPath(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/users", "list")
+	r.AddRoute("GET", "/users/:id/", "show")
+	r.AddRoute("GET", "/static/*file", "static")
+
+	if _, _, tsr := r.Lookup("GET", "/users/"); !tsr {
+		t.Error("tsr: /users/ should recommend /users")
+	}
+	if _, _, tsr := r.Lookup("GET", "/users/7"); !tsr {
+		t.Error("tsr: /users/7 should recommend /users/7/")
+	}
+	if _, _, tsr := r.Lookup("GET", "/nope/"); tsr {
+		t.Error("tsr: /nope/ has no variant")
+	}
+
+	cases := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"/USERS", "/users", true},
+		{"/Users/", "/users", true},
+		{"/USERS/AbC", "/users/AbC/", true},
+		{"/STATIC/Css/App.css", "/static/Css/App.css", true},
+		{"/other", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := r.FixedPath("GET", tc.path, true)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("FixedPath(%q): want %q %v, got %q %v", tc.path, tc.want, tc.ok, got, ok)
+		}
+	}
+	if _, ok := r.FixedPath("GET", "/Users/", false); ok {
+		t.Error("FixedPath without slash fixing: /Users/ should not match")
+	}
+
+	for in, want := range map[string]string{
+		"":            "/",
+		"a/b":         "/a/b",
+		"//a///b/":    "/a/b/",
+		"/a/./b/../c": "/a/c",
+		"/../a":       "/a",
+	} {
+		if got := CleanPath(in); got != want {
+			t.Errorf("CleanPath(%q): want %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestRouter_MixedSegments(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/files/:name.:ext", "file")
+	r.AddRoute("GET", "/files/:name", "bare")
+	r.AddRoute("GET", "/files/readme.md", "readme")
+	r.AddRoute("GET", "/v:version/users", "users")
+	r.AddRoute("GET", "/range/:from-:to<int>", "range")
+	r.AddRoute("GET", "/posts/:page<int>?", "posts")
+
+	cases := []struct {
+		path, want string
+		params     Params
+	}{
+		{"/files/archive.tar.gz", "file", Params{{"name", "archive.tar"}, {"ext", "gz"}}},
+		{"/files/notes", "bare", Params{{"name", "notes"}}},
+		{"/files/readme.md", "readme", nil}, // static first
+		{"/v2/users", "users", Params{{"version", "2"}}},
+		{"/range/a-b-3", "range", Params{{"from", "a-b"}, {"to", "3"}}},
+		{"/posts/4", "posts", Params{{"page", "4"}}},
+		{"/posts", "posts", nil},
+	}
+	for _, tc := range cases {
+		h, ps, found := r.Find("GET", tc.path)
+		if !found || h != tc.want {
+			t.Errorf("%s: want %s, got %v", tc.path, tc.want, h)
+			continue
+		}
+		if fmt.Sprint(ps) != fmt.Sprint(tc.params) {
+			t.Errorf("%s: want params %v, got %v", tc.path, tc.params, ps)
+		}
+	}
+	for _, path := range []string{"/posts/x", "/range/a-b", "/v/users"} {
+		if h, _, found := r.Find("GET", path); found {
+			t.Errorf("%s: want no match, got %v", path, h)
+		}
+	}
+
+	patterns, _ := Expand("/posts/:page<int>?")
+	if strings.Join(patterns, " ") != "/posts/:page<int> /posts" {
+		t.Errorf("Expand: got %v", patterns)
+	}
+}
+
+func TestRouter_RemoveAndReplace(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/users", "list")
+	r.AddRoute("GET", "/users/:id", "show")
+	r.AddRoute("GET", "/users/:id/posts", "posts")
+	r.AddRoute("GET", "/posts/:page?", "page")
+	r.SetDocumentation("GET", "/users/:id", "Show a user")
+
+	if h := r.Remove("GET", "/users/:name"); h != nil {
+		t.Errorf("Remove with another param name: got %v", h)
+	}
+	if h := r.Remove("GET", "/users/:id"); h != "show" {
+		t.Fatalf("Remove: got %v, want show", h)
+	}
+	if _, _, ok := r.Find("GET", "/users/7"); ok {
+		t.Error("/users/7 still matches after Remove")
+	}
+	if h, _, _ := r.Find("GET", "/users/7/posts"); h != "posts" {
+		t.Errorf("/users/7/posts = %v, want posts", h)
+	}
+	if d := r.Documentation("GET", "/users/:id"); d != "" {
+		t.Errorf("documentation kept after Remove: %q", d)
+	}
+
+	if h := r.Remove("GET", "/posts/:page?"); h != "page" {
+		t.Fatalf("Remove optional: got %v", h)
+	}
+	for _, path := range []string{"/posts", "/posts/2"} {
+		if _, _, ok := r.Find("GET", path); ok {
+			t.Errorf("%s still matches", path)
+		}
+	}
+
+	if old := r.Replace("GET", "/users", "list2"); old != "list" {
+		t.Errorf("Replace: got %v, want list", old)
+	}
+	if h, _, _ := r.Find("GET", "/users"); h != "list2" {
+		t.Errorf("/users = %v after Replace", h)
+	}
+	if old := r.Replace("GET", "/missing", "x"); old != nil {
+		t.Errorf("Replace missing: got %v", old)
+	}
+
+	// Removing everything drops the method; adding again works
+	r.Remove("GET", "/users")
+	r.Remove("GET", "/users/:id/posts")
+	if allow := r.Allowed("/users"); allow != "" {
+		t.Errorf("Allowed after removing all routes: %q", allow)
+	}
+	r.AddRoute("GET", "/users/:name", "again")
+	if h, ps, _ := r.Find("GET", "/users/ann"); h != "again" || ps.Get("name") != "ann" {
+		t.Errorf("re-added route: got %v %v", h, ps)
+	}
+}
+
+func TestRouter_ConcurrentChanges(t *testing.T) {
+	r := New()
+	r.AddRoute("GET", "/static", "static")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			path := fmt.Sprintf("/tenant%d/:id", i%10)
+			r.AddRoute("GET", path, "tenant")
+			r.Remove("GET", path)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// A published tree never changes under a lookup
+		if h, _, _ := r.Find("GET", "/static"); h != "static" {
+			t.Fatalf("/static = %v during concurrent changes", h)
+		}
+		r.Find("GET", "/tenant3/42")
+	}
+}
+
+// benchRouter registers a small API with static, param and catch-all routes.
+func benchRouter() *Router {
+	r := New()
+	for _, path := range []string{
+		"/", "/users", "/users/:id", "/users/:id/posts/:post", "/files/:name.:ext",
+		"/assets/*filepath", "/api/v1/health", "/api/v1/orders/:id<int>",
+	} {
+		r.AddRoute("GET", path, path)
+	}
+	return r
+}
+
+var benchPaths = []struct{ name, path string }{
+	{"Static", "/api/v1/health"},
+	{"Param", "/users/42/posts/7"},
+	{"Constraint", "/api/v1/orders/42"},
+	{"Mixed", "/files/report.pdf"},
+	{"CatchAll", "/assets/css/site.css"},
+}
+
+func TestRouter_MatchZeroAlloc(t *testing.T) {
+	r := benchRouter()
+	ps := make(Params, 0, r.MaxParams())
+	for _, bp := range benchPaths {
+		allocs := testing.AllocsPerRun(100, func() {
+			ps = ps[:0]
+			if h, _ := r.Match("GET", bp.path, &ps); h == nil {
+				t.Fatalf("%s: no match", bp.path)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocs per lookup, want 0", bp.name, allocs)
+		}
+	}
+}
+
+func BenchmarkRouter_Match(b *testing.B) {
+	r := benchRouter()
+	for _, bp := range benchPaths {
+		b.Run(bp.name, func(b *testing.B) {
+			ps := make(Params, 0, r.MaxParams())
+			b.ReportAllocs()
+			for b.Loop() {
+				ps = ps[:0]
+				r.Match("GET", bp.path, &ps)
+			}
+		})
+	}
+}
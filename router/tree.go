@@ -1,5 +1,11 @@
 package router
 
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
 // Handler is the request handler
 type Handler any
 
@@ -33,300 +39,605 @@ const (
 	catchAll
 )
 
+// Node is a node of the routing tree. Static children are radix-compressed
+// and indexed by their first byte. Param and catch-all children are kept
+// apart, so a lookup tries static, then param, then catch-all matches and
+// backtracks when a branch fails further down.
 type Node struct {
-	path      string
-	wildChild bool
-	nType     nodeType
-	indices   string
-	children  []*Node
-	handle    Handler
-	priority  uint32
+	path     string // static: edge label; param/catchAll: token as written (":id<int>")
+	nType    nodeType
+	indices  string  // first byte of each static child
+	children []*Node // static children
+	params   []*Node // param children, constrained before unconstrained
+	catchAll *Node
+	handle   Handler
+	priority uint32
+
+	// name and constraint of param and catchAll nodes
+	name       string
+	constraint *Constraint
+	// inSegment lists the first bytes of a param's static children that
+	// continue the segment (e.g. '.' in "/:name.:ext").
+	inSegment string
 }
 
-// incrementPriority increases the priority of the node and reorders children
-func (n *Node) incrementPriority(pos int) {
-	n.children[pos].priority++
-	prio := n.children[pos].priority
-
-	// Adjust position (move to front)
-	newPos := pos
-	for newPos > 0 && n.children[newPos-1].priority < prio {
-		// swap
-		n.children[newPos-1], n.children[newPos] = n.children[newPos], n.children[newPos-1]
-		newPos--
+// A param value runs to the end of its segment, or stops before static text
+// that shares the segment ("/:name.:ext"). firstEnd and nextEnd iterate the
+// candidate ends: such splits first, rightmost first, then the whole
+// segment. 0 means no more candidates.
+func (n *Node) firstEnd(path string, segEnd int) int {
+	if n.inSegment == "" {
+		return segEnd
 	}
+	if end := n.prevSplit(path, segEnd); end > 0 {
+		return end
+	}
+	return segEnd
+}
 
-	// Rebuild indices
-	if newPos != pos {
-		n.indices = n.indices[:newPos] + // Start
-			n.indices[pos:pos+1] + // Moved char
-			n.indices[newPos:pos] + // Shifted chars
-			n.indices[pos+1:] // End
+func (n *Node) nextEnd(path string, end, segEnd int) int {
+	if end == segEnd {
+		return 0
 	}
+	if end = n.prevSplit(path, end); end > 0 {
+		return end
+	}
+	return segEnd
 }
 
-// insert adds a route to the tree
-func (n *Node) insert(path string, handle Handler) {
-	fullPath := path
-	n.priority++
+// prevSplit returns the last index before 'before' (and after 0) where a
+// static child continues the segment, or 0.
+func (n *Node) prevSplit(path string, before int) int {
+	for i := before - 1; i > 0; i-- {
+		if strings.IndexByte(n.inSegment, path[i]) >= 0 {
+			return i
+		}
+	}
+	return 0
+}
 
-	// Empty tree
-	if n.path == "" && len(n.children) == 0 {
-		n.insertChild(path, fullPath, handle)
-		n.nType = root
-		return
+// insert adds a route to the tree. A pattern with an optional param is
+// inserted once with and once without it. The tree is left unchanged when
+// an error is returned.
+//
+// n must be a private copy (see clone); nodes below it are copied on the
+// way down before they are changed, so trees sharing them are unaffected.
+func (n *Node) insert(path string, handle Handler) error {
+	patterns, err := Expand(path)
+	if err != nil {
+		return errors.New(err.Error() + " in path '" + path + "'")
+	}
+	for _, pattern := range patterns {
+		if err := n.conflict(pattern); err != nil {
+			return err
+		}
 	}
+	for _, pattern := range patterns {
+		n.insertPattern(pattern, handle)
+	}
+	return nil
+}
 
-walk:
-	for {
-		// Find longest common prefix
-		// This also implies that the common prefix is a substring of "path"
-		i := longestCommonPrefix(path, n.path)
+// conflict walks the tree along a valid pattern without changing it and
+// reports whether inserting it would clash with a registered route. Two
+// wildcards at the same position conflict unless they are identical or
+// differ in their constraint.
+func (n *Node) conflict(path string) error {
+	wildcards, _ := Wildcards(path)
+	pos := 0
+	for _, w := range wildcards {
+		if w.Start > pos {
+			if n = n.staticNode(path[pos:w.Start]); n == nil {
+				return nil // new branch
+			}
+		}
+		token := path[w.Start:w.End]
 
-		// Split edge
-		if i < len(n.path) {
-			child := Node{
-				path:      n.path[i:],
-				wildChild: n.wildChild,
-				nType:     static,
-				indices:   n.indices,
-				children:  n.children,
-				handle:    n.handle,
-				priority:  n.priority - 1,
+		var next *Node
+		if w.CatchAll {
+			if next = n.catchAll; next != nil && next.path != token {
+				return conflictError(path, path[:w.Start], next, "wildcard '"+token+"' conflicts with '"+next.path+"'")
 			}
+		} else {
+			for _, child := range n.params {
+				if child.path == token {
+					next = child
+					break
+				}
+				if (child.constraint == nil) == (w.Constraint == nil) &&
+					(w.Constraint == nil || child.constraint.String() == w.Constraint.String()) {
+					return conflictError(path, path[:w.Start], child, "wildcard '"+token+"' conflicts with '"+child.path+"'")
+				}
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+		pos = w.End
+	}
+	if pos < len(path) {
+		if n = n.staticNode(path[pos:]); n == nil {
+			return nil
+		}
+	}
+	if n.handle != nil {
+		return conflictError(path, path[:len(path)-len(n.path)], n, "handlers are already registered")
+	}
+	return nil
+}
 
-			n.children = []*Node{&child}
-			// []byte for proper unicode handling could be better, but keeping simple
-			n.indices = string([]byte{n.path[i]})
-			n.path = path[:i]
-			n.handle = nil
-			n.wildChild = false
+// staticNode follows the static children along s and returns the node that
+// ends exactly at s, or nil if inserting s would create a new branch.
+func (n *Node) staticNode(s string) *Node {
+	for len(s) > 0 {
+		idx := strings.IndexByte(n.indices, s[0])
+		if idx < 0 {
+			return nil
+		}
+		child := n.children[idx]
+		if !strings.HasPrefix(s, child.path) {
+			return nil
 		}
+		s = s[len(child.path):]
+		n = child
+	}
+	return n
+}
 
-		// Make new node a child of this node
-		if i < len(path) {
-			path = path[i:]
-			c := path[0]
+// ConflictError reports a route that cannot be added because of a route
+// already in the tree.
+type ConflictError struct {
+	Path string
+	// Existing is a handler registered at or below the conflicting node,
+	// and ExistingPath the pattern it was registered with.
+	Existing     Handler
+	ExistingPath string
+	reason       string
+}
 
-			// '/' after param
-			if n.nType == param && c == '/' && len(n.children) == 1 {
-				n = n.children[0]
-				n.priority++
-				continue walk
-			}
+func (e *ConflictError) Error() string {
+	return "path '" + e.Path + "' conflicts with existing path '" + e.ExistingPath + "': " + e.reason
+}
 
-			// Check if a child with the next path byte exists
-			for i, max := 0, len(n.indices); i < max; i++ {
-				if n.indices[i] == c {
-					i = n.incrementChildPrio(i)
-					n = n.children[i]
-					continue walk
-				}
-			}
+// conflictError reports a clash of path with the routes below at; prefix
+// is the part of path leading to at.
+func conflictError(path, prefix string, at *Node, reason string) *ConflictError {
+	existing, suffix := at.firstHandle()
+	return &ConflictError{Path: path, Existing: existing, ExistingPath: prefix + suffix, reason: reason}
+}
 
-			// Otherwise insert it
-			if c != ':' && c != '*' {
-				// []byte for proper unicode handling could be better
-				n.indices += string([]byte{c})
-				child := &Node{}
-				n.children = append(n.children, child)
-				n.incrementPriority(len(n.indices) - 1)
-				n = child
+// firstHandle returns a handler registered at n or below it, and its
+// pattern from n down.
+func (n *Node) firstHandle() (Handler, string) {
+	if n.handle != nil {
+		return n.handle, n.path
+	}
+	children := append(append([]*Node(nil), n.children...), n.params...)
+	if n.catchAll != nil {
+		children = append(children, n.catchAll)
+	}
+	for _, child := range children {
+		if h, suffix := child.firstHandle(); h != nil {
+			return h, n.path + suffix
+		}
+	}
+	return nil, ""
+}
+
+// insertPattern adds a single pattern that conflict has accepted.
+func (n *Node) insertPattern(path string, handle Handler) {
+	wildcards, _ := Wildcards(path)
+	n.nType = root
+	n.priority++
+
+	pos := 0
+	for _, w := range wildcards {
+		if w.Start > pos {
+			n = n.addStatic(path[pos:w.Start])
+		}
+		n = n.addWildcard(w, path)
+		pos = w.End
+	}
+	if pos < len(path) {
+		n = n.addStatic(path[pos:])
+	}
+	n.handle = handle
+}
+
+// addStatic descends along the static children matching s, splitting edges
+// and adding nodes as needed, and returns the node that ends at s.
+func (n *Node) addStatic(s string) *Node {
+	for len(s) > 0 {
+		idx := strings.IndexByte(n.indices, s[0])
+		if idx < 0 {
+			child := &Node{path: s}
+			if n.nType == param && s[0] != '/' {
+				n.inSegment += s[:1]
 			}
-			n.insertChild(path, fullPath, handle)
-			return
+			n.indices += s[:1]
+			n.children = append(n.children, child)
+			n.incrementChildPrio(len(n.children) - 1)
+			return child
 		}
 
-		// Otherwise add handle to current node
-		if n.handle != nil {
-			panic("handlers are already registered for path '" + fullPath + "'")
+		n.children[idx] = n.children[idx].clone()
+		idx = n.incrementChildPrio(idx)
+		child := n.children[idx]
+
+		// Split edge
+		i := longestCommonPrefix(s, child.path)
+		if i < len(child.path) {
+			split := *child
+			split.path = child.path[i:]
+			split.priority = child.priority - 1
+			*child = Node{
+				path:     child.path[:i],
+				indices:  split.path[:1],
+				children: []*Node{&split},
+				priority: child.priority,
+			}
 		}
-		n.handle = handle
-		return
+		s = s[i:]
+		n = child
 	}
+	return n
 }
 
-func (n *Node) insertChild(path, fullPath string, handle Handler) {
-	for {
-		// Find prefix until first wildcard
-		wildcard, i, valid := findWildcard(path)
-		if i < 0 { // No wildcard
-			break
+// addWildcard returns the param or catch-all child for w, creating it if
+// needed. Conflicts have been ruled out by conflict.
+func (n *Node) addWildcard(w Wildcard, fullPath string) *Node {
+	token := fullPath[w.Start:w.End]
+
+	if w.CatchAll {
+		if n.catchAll == nil {
+			n.catchAll = &Node{path: token, nType: catchAll, name: w.Name}
+		} else {
+			n.catchAll = n.catchAll.clone()
 		}
+		n.catchAll.priority++
+		return n.catchAll
+	}
 
-		// The wildcard name must not contain ':' and '*'
-		if !valid {
-			panic("only one wildcard per path segment is allowed, has: '" +
-				wildcard + "' in path '" + fullPath + "'")
+	for i, child := range n.params {
+		if child.path == token {
+			child = child.clone()
+			child.priority++
+			n.params[i] = child
+			return child
 		}
+	}
 
-		// Check if the wildcard has an existing node
-		if len(n.children) > 0 {
-			// If we are here, we exist, and since we are a wildcard,
-			// we must have only one child.
-			if len(n.children) != 1 {
-				// Logic error or conflict
-			}
-			// Validate if the existing wildcard matches the new one?
-			// For simplicity, assuming no conflicting wildcard names at same level for now.
+	child := &Node{
+		path:       token,
+		nType:      param,
+		name:       w.Name,
+		constraint: w.Constraint,
+		priority:   1,
+	}
+	// Constrained params are tried first, in registration order
+	pos := len(n.params)
+	if child.constraint != nil {
+		for pos > 0 && n.params[pos-1].constraint == nil {
+			pos--
 		}
+	}
+	n.params = append(n.params, nil)
+	copy(n.params[pos+1:], n.params[pos:])
+	n.params[pos] = child
+	return child
+}
 
-		if wildcard[0] == ':' { // param
-			if i > 0 {
-				n.path = path[:i]
-				path = path[i:]
-			}
+// remove deletes the route registered with exactly the given pattern and
+// returns its handle, or nil if there is none. A pattern with an optional
+// param is removed in both forms. Like insert, n must be a private copy.
+func (n *Node) remove(path string) Handler {
+	patterns, err := Expand(path)
+	if err != nil {
+		return nil
+	}
+	for _, pattern := range patterns {
+		if n.lookupPattern(pattern) == nil {
+			return nil
+		}
+	}
+	var handle Handler
+	for _, pattern := range patterns {
+		wildcards, _ := Wildcards(pattern)
+		handle = n.removePattern(pattern, 0, wildcards)
+		n.priority--
+	}
+	return handle
+}
 
-			child := &Node{
-				nType: param,
-				path:  wildcard,
+// lookupPattern returns the node registered with exactly pattern, or nil.
+func (n *Node) lookupPattern(pattern string) *Node {
+	wildcards, _ := Wildcards(pattern)
+	pos := 0
+	for _, w := range wildcards {
+		if w.Start > pos {
+			if n = n.staticNode(pattern[pos:w.Start]); n == nil {
+				return nil
 			}
-			n.children = []*Node{child}
-			n.wildChild = true
-			n = child
-			n.priority++
-
-			// If the path doesn't end with the wildcard, then there
-			// will be another non-wildcard sub-path starting with '/'
-			if len(wildcard) < len(path) {
-				path = path[len(wildcard):]
-				child := &Node{
-					priority: 1,
-				}
-				n.children = []*Node{child}
-				n = child
+		}
+		n = n.wildcardChild(pattern[w.Start:w.End], w.CatchAll)
+		if n == nil {
+			return nil
+		}
+		pos = w.End
+	}
+	if pos < len(pattern) {
+		if n = n.staticNode(pattern[pos:]); n == nil {
+			return nil
+		}
+	}
+	if n.handle == nil {
+		return nil
+	}
+	return n
+}
+
+// wildcardChild returns the param or catch-all child written as token.
+func (n *Node) wildcardChild(token string, isCatchAll bool) *Node {
+	if isCatchAll {
+		if n.catchAll != nil && n.catchAll.path == token {
+			return n.catchAll
+		}
+		return nil
+	}
+	for _, child := range n.params {
+		if child.path == token {
+			return child
+		}
+	}
+	return nil
+}
+
+// removePattern removes path[pos:], which lookupPattern has found, below
+// n. Nodes on the way are copied, lose one priority and are dropped when
+// they are left empty.
+func (n *Node) removePattern(path string, pos int, wildcards []Wildcard) Handler {
+	if pos == len(path) {
+		handle := n.handle
+		n.handle = nil
+		return handle
+	}
+
+	if len(wildcards) > 0 && wildcards[0].Start == pos {
+		w := wildcards[0]
+		if w.CatchAll {
+			child := n.catchAll.clone()
+			handle := child.removePattern(path, w.End, wildcards[1:])
+			n.catchAll = child.pruned()
+			return handle
+		}
+		for i, child := range n.params {
+			if child.path != path[w.Start:w.End] {
 				continue
 			}
-			// Otherwise we're done. Insert the handle in the new leaf
-			n.handle = handle
-			return
+			child = child.clone()
+			handle := child.removePattern(path, w.End, wildcards[1:])
+			if child = child.pruned(); child != nil {
+				n.params[i] = child
+			} else {
+				n.params = append(n.params[:i], n.params[i+1:]...)
+			}
+			return handle
+		}
+		return nil
+	}
 
-		} else { // catchAll
-			if i+len(wildcard) != len(path) {
-				panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
+	idx := strings.IndexByte(n.indices, path[pos])
+	child := n.children[idx].clone()
+	handle := child.removePattern(path, pos+len(child.path), wildcards)
+	if child = child.pruned(); child != nil {
+		n.children[idx] = child
+		// Move the child back behind siblings that now outrank it
+		for idx+1 < len(n.children) && n.children[idx+1].priority > child.priority {
+			n.children[idx], n.children[idx+1] = n.children[idx+1], child
+			n.indices = n.indices[:idx] + n.indices[idx+1:idx+2] + n.indices[idx:idx+1] + n.indices[idx+2:]
+			idx++
+		}
+	} else {
+		n.children = append(n.children[:idx], n.children[idx+1:]...)
+		n.indices = n.indices[:idx] + n.indices[idx+1:]
+		if n.nType == param {
+			n.inSegment = ""
+			for _, c := range n.children {
+				if c.path[0] != '/' {
+					n.inSegment += c.path[:1]
+				}
 			}
-			// if len(n.path) > 0 && n.path[len(n.path)-1] == '/' {
-			// 	panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'")
-			// }
-			// Currently fixed prefix required currently (TODO: fix)
-			if i > 0 {
-				n.path = path[:i]
-				path = path[i:]
+		}
+	}
+	return handle
+}
+
+// pruned returns n with one route removed below it: nil if nothing is left,
+// merged into its only static child if that is all it holds, else n.
+func (n *Node) pruned() *Node {
+	n.priority--
+	if n.handle != nil || len(n.params) > 0 || n.catchAll != nil {
+		return n
+	}
+	switch {
+	case len(n.children) == 0:
+		return nil
+	case len(n.children) == 1 && n.nType == static:
+		child := n.children[0].clone()
+		child.path = n.path + child.path
+		return child
+	}
+	return n
+}
+
+// clone returns a shallow copy of n with its own child slices, so it can
+// be changed without affecting trees that share n.
+func (n *Node) clone() *Node {
+	c := *n
+	c.children = slices.Clone(n.children)
+	c.params = slices.Clone(n.params)
+	return &c
+}
+
+// getValue returns the handle registered with the given path (key),
+// appending the values of wildcards to p.
+// When nothing matches, p is restored and tsr (trailing slash redirect)
+// reports whether a route exists for the path with the trailing slash
+// added or removed.
+func (n *Node) getValue(path string, p *Params) (handle Handler, tsr bool) {
+	start := len(*p)
+	if handle = n.match(path, p); handle != nil {
+		return handle, false
+	}
+
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		tsr = n.match(path[:len(path)-1], p) != nil
+	} else if path != "" {
+		tsr = n.match(path+"/", p) != nil
+	}
+	*p = (*p)[:start]
+	return nil, tsr
+}
+
+// match looks up path below n, whose own path has already been consumed.
+// Static children are tried first, then params, then the catch-all; a
+// branch that fails further down falls through to the next candidate.
+func (n *Node) match(path string, p *Params) Handler {
+	if path == "" {
+		return n.handle
+	}
+
+	if idx := strings.IndexByte(n.indices, path[0]); idx >= 0 {
+		child := n.children[idx]
+		if strings.HasPrefix(path, child.path) {
+			if h := child.match(path[len(child.path):], p); h != nil {
+				return h
 			}
+		}
+	}
 
-			child := &Node{
-				nType: catchAll,
-				path:  wildcard,
+	if len(n.params) > 0 {
+		segEnd := strings.IndexByte(path, '/')
+		if segEnd < 0 {
+			segEnd = len(path)
+		}
+		for _, child := range n.params {
+			for end := child.firstEnd(path, segEnd); end > 0; end = child.nextEnd(path, end, segEnd) {
+				value := path[:end]
+				if child.constraint != nil && !child.constraint.Match(value) {
+					continue
+				}
+				i := len(*p)
+				addParam(p, child.name, value)
+				if h := child.match(path[end:], p); h != nil {
+					return h
+				}
+				*p = (*p)[:i]
 			}
-			n.children = []*Node{child}
-			n.wildChild = true
-			n = child
-			n.priority++
-			n.handle = handle
-			return
 		}
 	}
 
-	// If no wildcard, simple insertion
-	n.path = path
-	n.handle = handle
+	if n.catchAll != nil {
+		addParam(p, n.catchAll.name, path)
+		return n.catchAll.handle
+	}
+	return nil
 }
 
-// getValue returns the handle registered with the given path (key). The values of
-// wildcards are saved to a slice.
-func (n *Node) getValue(path string) (handle Handler, p Params, tsr bool) {
-walk: // Outer loop for walking the tree
-	for {
-		prefix := n.path
-		if len(path) > len(prefix) {
-			if path[:len(prefix)] == prefix {
-				path = path[len(prefix):]
-
-				// If this node does not have a wildcard (param or catchAll)
-				// child,  we must look up the next child node
-				if !n.wildChild {
-					idxc := path[0]
-					for i, c := range []byte(n.indices) {
-						if c == idxc {
-							n = n.children[i]
-							continue walk
-						}
-					}
-					// Nothing found.
-					// TSR: If the path is equal to prefix + '/', return TSR=true?
-					// For now, no.
-					return nil, nil, false
-				}
+// findCaseInsensitive returns the registered spelling of path, matching
+// static segments case-insensitively. Param and catch-all values are kept
+// as given. With fixTrailingSlash, a missing or extra trailing slash is
+// corrected as well.
+func (n *Node) findCaseInsensitive(path string, fixTrailingSlash bool) (string, bool) {
+	out, ok := n.matchFold(path, make([]byte, 0, len(path)+1), fixTrailingSlash)
+	return string(out), ok
+}
 
-				// Handle wildcard child
-				n = n.children[0]
-				switch n.nType {
-				case param:
-					handle, p, pathLeft, nextN, returnNow := n.getValueParam(path, p)
-					if returnNow {
-						return handle, p, false
-					}
-					if nextN == nil {
-						return nil, nil, false
-					}
-					path, n = pathLeft, nextN
-					continue walk
-				case catchAll:
-					handle, p = n.getValueCatchAll(path, p)
-					return handle, p, false
-				default:
-					panic("invalid node type")
+// matchFold is match for findCaseInsensitive, appending the canonical path
+// to out. Branches that fail may leave garbage past len(out) in the shared
+// buffer; each branch appends from the same length, so it is overwritten.
+func (n *Node) matchFold(path string, out []byte, fixTrailingSlash bool) ([]byte, bool) {
+	if path == "" {
+		if n.handle != nil {
+			return out, true
+		}
+		if fixTrailingSlash {
+			// Add the missing trailing slash
+			if idx := strings.IndexByte(n.indices, '/'); idx >= 0 {
+				if child := n.children[idx]; child.path == "/" && child.handle != nil {
+					return append(out, '/'), true
 				}
 			}
-		} else if path == prefix {
-			// specific handler
-			if handle = n.handle; handle != nil {
-				return handle, p, false
+		}
+		return nil, false
+	}
+
+	for _, child := range n.children {
+		if len(path) >= len(child.path) && strings.EqualFold(path[:len(child.path)], child.path) {
+			if res, ok := child.matchFold(path[len(child.path):], append(out, child.path...), fixTrailingSlash); ok {
+				return res, true
 			}
-			// If not found, and path == prefix, and we have wildChild...
-			// e.g. /users matches /users/:id ? No.
 		}
-		return nil, nil, false
+		// Add the missing trailing slash at the end of an edge
+		if fixTrailingSlash && len(path)+1 == len(child.path) && child.path[len(path)] == '/' &&
+			child.handle != nil && strings.EqualFold(path, child.path[:len(path)]) {
+			return append(out, child.path...), true
+		}
 	}
-}
 
-// getValueParam handles a param node: extracts segment, appends to p, and returns either
-// (handle, p, "", nil, true) to return, or ("", p, pathRest, nextNode, false) to continue.
-func (n *Node) getValueParam(path string, p Params) (handle Handler, outP Params, pathRest string, nextNode *Node, returnNow bool) {
-	end := 0
-	for end < len(path) && path[end] != '/' {
-		end++
+	if len(n.params) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		for _, child := range n.params {
+			for e := child.firstEnd(path, end); e > 0; e = child.nextEnd(path, e, end) {
+				value := path[:e]
+				if child.constraint != nil && !child.constraint.Match(value) {
+					continue
+				}
+				if res, ok := child.matchFold(path[e:], append(out, value...), fixTrailingSlash); ok {
+					return res, true
+				}
+			}
+		}
 	}
-	if p == nil {
-		p = make(Params, 0, 4)
+
+	if n.catchAll != nil && n.catchAll.handle != nil {
+		return append(out, path...), true
 	}
-	i := len(p)
-	p = p[:i+1]
-	p[i].Key = n.path[1:]
-	p[i].Value = path[:end]
 
-	if end < len(path) {
-		if len(n.children) > 0 {
-			return nil, p, path[end:], n.children[0], false
-		}
-		return nil, nil, "", nil, true // no child to go to
+	// Drop the extra trailing slash
+	if fixTrailingSlash && path == "/" && n.handle != nil {
+		return out, true
 	}
-	if n.handle != nil {
-		return n.handle, p, "", nil, true
+	return nil, false
+}
+
+// addParam appends a param, allocating room for a few more on first use.
+func addParam(p *Params, key, value string) {
+	if cap(*p) == 0 {
+		*p = make(Params, 0, 4)
 	}
-	return nil, nil, "", nil, true // path consumed but no handle
+	*p = append(*p, Param{Key: key, Value: value})
 }
 
-// getValueCatchAll handles a catchAll node: the rest of path is the param value.
-func (n *Node) getValueCatchAll(path string, p Params) (handle Handler, outP Params) {
-	if p == nil {
-		p = make(Params, 0, 4)
+// walk calls walkFunc with the pattern of every route below n.
+func (n *Node) walk(path string, walkFunc func(path string)) {
+	fullPath := path + n.path
+	if n.handle != nil {
+		walkFunc(fullPath)
+	}
+	for _, child := range n.children {
+		child.walk(fullPath, walkFunc)
+	}
+	for _, child := range n.params {
+		child.walk(fullPath, walkFunc)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(fullPath, walkFunc)
 	}
-	i := len(p)
-	p = p[:i+1]
-	p[i].Key = n.path[1:]
-	p[i].Value = path
-	return n.handle, p
 }
 
 // Helpers
@@ -365,27 +676,3 @@ func longestCommonPrefix(a, b string) int {
 	}
 	return i
 }
-
-// findWildcard searches for a wildcard segment
-func findWildcard(path string) (wildcard string, i int, valid bool) {
-	// Find start
-	for start, c := range []byte(path) {
-		// A wildcard starts with ':' (param) or '*' (catch-all)
-		if c != ':' && c != '*' {
-			continue
-		}
-
-		// Find end and check for invalid characters
-		valid = true
-		for end, c := range []byte(path[start+1:]) {
-			switch c {
-			case '/':
-				return path[start : start+1+end], start, valid
-			case ':', '*':
-				valid = false
-			}
-		}
-		return path[start:], start, valid
-	}
-	return "", -1, false
-}
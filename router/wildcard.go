@@ -0,0 +1,251 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Wildcard is a parameter in a route pattern: ":name", ":name<constraint>",
+// an optional trailing ":name?" or "*name".
+type Wildcard struct {
+	Name       string
+	Constraint *Constraint // nil when unconstrained
+	CatchAll   bool
+	Optional   bool
+	// Start and End are the byte offsets of the token in the pattern.
+	Start, End int
+}
+
+// Wildcards parses the parameters of a route pattern, in order.
+//
+// A param name is made of letters, digits and '_', so a segment may mix
+// params and static text: "/files/:name.:ext", "/v:version". A param may
+// carry a constraint in angle brackets: a built-in name (see Constraint) or
+// a regular expression that must match the whole value. The last param may
+// be optional ("/posts/:page?") if it is a whole segment. A catch-all must
+// end the pattern.
+func Wildcards(pattern string) ([]Wildcard, error) {
+	var wildcards []Wildcard
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != ':' && c != '*' {
+			continue
+		}
+		if i > 0 && len(wildcards) > 0 && wildcards[len(wildcards)-1].End == i {
+			return nil, errors.New("wildcards must be separated by static text, has: '" +
+				segmentAt(pattern, i) + "'")
+		}
+
+		w := Wildcard{CatchAll: c == '*', Start: i}
+		end := i + 1
+		if w.CatchAll {
+			for end < len(pattern) && pattern[end] != '/' {
+				if pattern[end] == ':' || pattern[end] == '*' || pattern[end] == '<' {
+					break
+				}
+				end++
+			}
+		} else {
+			for end < len(pattern) && isNameByte(pattern[end]) {
+				end++
+			}
+		}
+		w.Name = pattern[i+1 : end]
+		if w.Name == "" {
+			return nil, errors.New("wildcards must be named with a non-empty name")
+		}
+
+		if end < len(pattern) && pattern[end] == '<' {
+			if w.CatchAll {
+				return nil, errors.New("catch-all '*" + w.Name + "' cannot have a constraint")
+			}
+			close := constraintEnd(pattern, end)
+			if close < 0 {
+				return nil, errors.New("unterminated constraint for ':" + w.Name + "'")
+			}
+			constraint, err := ParseConstraint(pattern[end+1 : close])
+			if err != nil {
+				return nil, err
+			}
+			w.Constraint = constraint
+			end = close + 1
+		}
+		if end < len(pattern) && pattern[end] == '?' && !w.CatchAll {
+			if end+1 != len(pattern) || i == 0 || pattern[i-1] != '/' {
+				return nil, errors.New("only a trailing param that is a whole segment can be optional, has: '" +
+					segmentAt(pattern, i) + "'")
+			}
+			w.Optional = true
+			end++
+		}
+		w.End = end
+
+		if w.CatchAll && end != len(pattern) {
+			return nil, errors.New("catch-all routes are only allowed at the end of the path")
+		}
+		wildcards = append(wildcards, w)
+		i = end - 1
+	}
+	return wildcards, nil
+}
+
+// Expand returns the concrete patterns a route pattern registers: the
+// pattern itself and, for an optional trailing param, the pattern without
+// that segment ("/posts/:page?" is "/posts/:page" and "/posts").
+func Expand(pattern string) ([]string, error) {
+	wildcards, err := Wildcards(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(wildcards) == 0 || !wildcards[len(wildcards)-1].Optional {
+		return []string{pattern}, nil
+	}
+	w := wildcards[len(wildcards)-1]
+	without := pattern[:w.Start-1]
+	if without == "" {
+		without = "/"
+	}
+	return []string{pattern[:len(pattern)-1], without}, nil
+}
+
+func isNameByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// constraintEnd returns the index of the '>' closing the '<' at open,
+// allowing nested brackets such as regexp named groups.
+func constraintEnd(pattern string, open int) int {
+	depth := 0
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// segmentAt returns the path segment containing index i.
+func segmentAt(pattern string, i int) string {
+	start := strings.LastIndexByte(pattern[:i], '/') + 1
+	end := strings.IndexByte(pattern[i:], '/')
+	if end < 0 {
+		return pattern[start:]
+	}
+	return pattern[start : i+end]
+}
+
+// Constraint restricts the values a path parameter matches. Built-in
+// constraints are:
+//
+//	int    optionally signed decimal integer fitting in 64 bits
+//	uint   unsigned decimal integer fitting in 64 bits
+//	float  decimal floating point number
+//	uuid   8-4-4-4-12 hexadecimal UUID
+//	alpha  ASCII letters
+//	alnum  ASCII letters and digits
+//
+// Anything else is compiled as a regular expression anchored at both ends.
+type Constraint struct {
+	expr  string
+	re    *regexp.Regexp // nil for built-ins
+	match func(string) bool
+}
+
+var builtinConstraints = map[string]func(string) bool{
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uint": func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	},
+	"float": func(s string) bool {
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	},
+	"uuid":  isUUID,
+	"alpha": func(s string) bool { return allBytes(s, isAlpha) },
+	"alnum": func(s string) bool {
+		return allBytes(s, func(c byte) bool { return isAlpha(c) || '0' <= c && c <= '9' })
+	},
+}
+
+// ParseConstraint compiles the text between a param's angle brackets.
+func ParseConstraint(expr string) (*Constraint, error) {
+	if expr == "" {
+		return nil, errors.New("empty constraint")
+	}
+	if fn, ok := builtinConstraints[expr]; ok {
+		return &Constraint{expr: expr, match: fn}, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint <%s>: %w", expr, err)
+	}
+	return &Constraint{expr: expr, re: re, match: re.MatchString}, nil
+}
+
+// Match reports whether value satisfies the constraint.
+func (c *Constraint) Match(value string) bool {
+	return c.match(value)
+}
+
+// String returns the constraint as written, without brackets.
+func (c *Constraint) String() string {
+	return c.expr
+}
+
+// Builtin reports whether the constraint is one of the named built-ins
+// rather than a regular expression.
+func (c *Constraint) Builtin() bool {
+	return c.re == nil
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func allBytes(s string, ok func(byte) bool) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !ok(s[i]) {
+			return false
+		}
+	}
+	return true
+}
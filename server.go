@@ -0,0 +1,444 @@
+package kvolt
+
+import (
+	stdContext "context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Default server timeouts for production (slowloris protection and connection hygiene).
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+
+	// DefaultShutdownTimeout is the grace period for in-flight requests on shutdown.
+	DefaultShutdownTimeout = 5 * time.Second
+
+	// DefaultRestartTimeout is how long a graceful restart waits for the new process.
+	DefaultRestartTimeout = 30 * time.Second
+)
+
+// ServerConfig configures Engine.Server.
+// At least one of Addr, TLSAddr or Listener must be set.
+type ServerConfig struct {
+	// Addr is the plain HTTP address (e.g. ":8080").
+	Addr string
+
+	// TLSAddr is the HTTPS address (e.g. ":8443"). HTTP/2 is enabled automatically.
+	TLSAddr string
+	// CertFile and KeyFile are used for TLSAddr. They may be empty when
+	// TLSConfig already provides certificates.
+	CertFile string
+	KeyFile  string
+	// TLSConfig is an optional TLS configuration for TLSAddr.
+	TLSConfig *tls.Config
+
+	// Listener is a pre-built listener served with plain HTTP
+	// (e.g. a unix socket or a socket handed over by a supervisor).
+	Listener net.Listener
+
+	// AdminAddr serves AdminHandler on a separate port (metrics, pprof, ...).
+	AdminAddr string
+	// AdminHandler is the handler for AdminAddr. Default: http.DefaultServeMux.
+	AdminHandler http.Handler
+
+	// Timeouts. Zero values use the Default*Timeout constants.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+
+	// DrainDelay keeps serving after shutdown begins while Engine.Ready reports
+	// false, so load balancers can take the instance out of rotation before
+	// the listeners close. Default: 0.
+	DrainDelay time.Duration
+
+	// Signals that trigger a graceful shutdown. Default: SIGINT, SIGTERM.
+	Signals []os.Signal
+	// DisableSignals disables signal handling; stop the server with Engine.Shutdown.
+	DisableSignals bool
+
+	// GracefulRestart enables zero-downtime restarts: on one of RestartSignals
+	// the Addr, TLSAddr and AdminAddr sockets are handed to a freshly exec'd
+	// copy of the binary, and this process drains once the new one is ready.
+	// A custom Listener is not handed over. Not supported on Windows.
+	GracefulRestart bool
+	// RestartSignals trigger a graceful restart. Default: SIGHUP, SIGUSR2.
+	RestartSignals []os.Signal
+	// RestartTimeout bounds the wait for the new process to become ready.
+	// Default: DefaultRestartTimeout.
+	RestartTimeout time.Duration
+
+	// Logger receives startup and shutdown messages. Default: stdout.
+	Logger *log.Logger
+}
+
+func (cfg *ServerConfig) setDefaults() {
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = DefaultReadTimeout
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if len(cfg.Signals) == 0 {
+		cfg.Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	if len(cfg.RestartSignals) == 0 {
+		cfg.RestartSignals = defaultRestartSignals
+	}
+	if cfg.RestartTimeout == 0 {
+		cfg.RestartTimeout = DefaultRestartTimeout
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(os.Stdout, "", 0)
+	}
+	if cfg.AdminHandler == nil {
+		cfg.AdminHandler = http.DefaultServeMux
+	}
+}
+
+func (cfg *ServerConfig) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// listener pairs a server with the socket it serves.
+type listener struct {
+	srv    *http.Server
+	ln     net.Listener
+	addr   string // configured address; empty for ServerConfig.Listener
+	tls    bool
+	scheme string
+}
+
+// Server starts every listener configured in config and blocks until a
+// shutdown signal arrives, Engine.Shutdown is called, or a listener fails.
+// In-flight requests are then drained for up to config.ShutdownTimeout.
+func (e *Engine) Server(config ServerConfig) error {
+	config.setDefaults()
+	if err := e.Validate(); err != nil {
+		if config.Listener != nil {
+			config.Listener.Close()
+		}
+		return err
+	}
+	e.Build()
+
+	listeners, err := e.listen(&config)
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		return errors.New("kvolt: no address or listener configured")
+	}
+
+	closeAll := func() {
+		for _, l := range listeners {
+			l.ln.Close()
+		}
+	}
+
+	e.srvMu.Lock()
+	if e.shutdown {
+		e.srvMu.Unlock()
+		closeAll()
+		return http.ErrServerClosed
+	}
+	e.drainDelay = config.DrainDelay
+	e.srvMu.Unlock()
+
+	if err := e.runStartHooks(stdContext.Background()); err != nil {
+		closeAll()
+		if stopErr := e.runShutdownHooks(stdContext.Background()); stopErr != nil {
+			config.Logger.Println("Shutdown hooks error:", stopErr)
+		}
+		return err
+	}
+
+	e.srvMu.Lock()
+	if e.shutdown {
+		// Shutdown ran during the start hooks and found nothing to stop
+		e.srvMu.Unlock()
+		closeAll()
+		if err := e.runShutdownHooks(stdContext.Background()); err != nil {
+			config.Logger.Println("Shutdown hooks error:", err)
+		}
+		return http.ErrServerClosed
+	}
+	e.started = true
+	for _, l := range listeners {
+		e.servers = append(e.servers, l.srv)
+	}
+	e.srvMu.Unlock()
+
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		config.Logger.Printf("⚡ KVolt is running on %s://%s", l.scheme, displayAddr(l.ln.Addr()))
+		go func(l listener) {
+			if l.tls {
+				errCh <- l.srv.ServeTLS(l.ln, config.CertFile, config.KeyFile)
+				return
+			}
+			errCh <- l.srv.Serve(l.ln)
+		}(l)
+	}
+
+	e.ready.Store(true)
+	if err := notifyParentReady(); err != nil {
+		config.Logger.Println("Restart: could not notify parent process:", err)
+	}
+
+	var quit, restart chan os.Signal
+	if !config.DisableSignals {
+		quit = make(chan os.Signal, 1)
+		signal.Notify(quit, config.Signals...)
+		defer signal.Stop(quit)
+		if config.GracefulRestart && len(config.RestartSignals) > 0 {
+			restart = make(chan os.Signal, 1)
+			signal.Notify(restart, config.RestartSignals...)
+			defer signal.Stop(restart)
+		}
+		config.Logger.Println("Press Ctrl+C to stop")
+	}
+
+	var serveErr error
+wait:
+	for {
+		select {
+		case <-quit:
+			config.Logger.Println("\nShutting down server...")
+			break wait
+		case <-restart:
+			if err := e.restart(&config, listeners); err != nil {
+				// Keep serving; the old process is still healthy
+				config.Logger.Println("Restart failed:", err)
+				continue
+			}
+			config.Logger.Println("New process is ready, shutting down...")
+			break wait
+		case serveErr = <-errCh:
+			if errors.Is(serveErr, http.ErrServerClosed) {
+				// Engine.Shutdown was called; it drains the servers itself
+				return nil
+			}
+			config.Logger.Printf("Listen: %s", serveErr)
+			break wait
+		}
+	}
+
+	ctx, cancel := stdContext.WithTimeout(stdContext.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		config.Logger.Println("Server Shutdown Error:", err)
+		return err
+	}
+
+	config.Logger.Println("Server exiting")
+	return serveErr
+}
+
+// listen opens every socket up front so address errors are returned immediately.
+// Sockets inherited from a restarting parent or from systemd socket
+// activation (LISTEN_FDS) are used instead of binding new ones.
+func (e *Engine) listen(cfg *ServerConfig) ([]listener, error) {
+	inherited, activated, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Close inherited sockets the config no longer asks for
+		for _, ln := range inherited {
+			ln.Close()
+		}
+		for _, ln := range activated {
+			ln.Close()
+		}
+	}()
+
+	var listeners []listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.ln.Close()
+		}
+	}
+
+	if cfg.Listener != nil {
+		scheme := "http"
+		if cfg.Listener.Addr().Network() == "unix" {
+			scheme = "unix"
+		}
+		listeners = append(listeners, listener{srv: cfg.newServer(e), ln: cfg.Listener, scheme: scheme})
+	}
+
+	type spec struct {
+		addr    string
+		handler http.Handler
+		tls     bool
+	}
+	specs := []spec{
+		{cfg.Addr, e, false},
+		{cfg.TLSAddr, e, true},
+		{cfg.AdminAddr, cfg.AdminHandler, false},
+	}
+	for _, s := range specs {
+		if s.addr == "" {
+			continue
+		}
+		var ln net.Listener
+		if inheritedLn, ok := inherited[s.addr]; ok {
+			ln = inheritedLn
+			delete(inherited, s.addr)
+		} else if len(activated) > 0 {
+			ln, activated = activated[0], activated[1:]
+		} else if ln, err = net.Listen("tcp", s.addr); err != nil {
+			closeAll()
+			return nil, err
+		}
+		l := listener{srv: cfg.newServer(s.handler), ln: ln, addr: s.addr, tls: s.tls, scheme: "http"}
+		if s.tls {
+			l.srv.TLSConfig = cfg.TLSConfig
+			l.scheme = "https"
+		}
+		listeners = append(listeners, l)
+	}
+
+	// Socket activation without any configured address: serve plain HTTP on the first socket
+	if len(listeners) == 0 && len(activated) > 0 {
+		listeners = append(listeners, listener{srv: cfg.newServer(e), ln: activated[0], scheme: "http"})
+		activated = activated[1:]
+	}
+	return listeners, nil
+}
+
+// displayAddr renders ":8080"-style addresses as "localhost:8080".
+func displayAddr(addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return addr.String()
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if host == "" || host == "::" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Shutdown gracefully stops every server started by Server, Run, RunTLS,
+// RunListener or RunUnix. It flips readiness off, waits for the configured
+// DrainDelay, drains in-flight requests until ctx expires, and finally runs
+// the OnShutdown hooks (each bounded by its own timeout, not by ctx).
+// Streams (c.Stream, c.StreamEvents) end when the drain starts, so their
+// connections do not hold it up.
+// It is safe to call from another goroutine, e.g. in tests.
+func (e *Engine) Shutdown(ctx stdContext.Context) error {
+	e.srvMu.Lock()
+	first := !e.shutdown
+	e.shutdown = true
+	servers := e.servers
+	e.servers = nil
+	runHooks := first && e.started
+	drainDelay := e.drainDelay
+	e.srvMu.Unlock()
+
+	e.ready.Store(false)
+	if first && drainDelay > 0 && len(servers) > 0 {
+		select {
+		case <-time.After(drainDelay):
+		case <-ctx.Done():
+		}
+	}
+	if first {
+		close(e.closing)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+
+	if runHooks {
+		errs = append(errs, e.runShutdownHooks(stdContext.WithoutCancel(ctx)))
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts the HTTP server with Graceful Shutdown and production timeouts.
+func (e *Engine) Run(addr string) error {
+	return e.Server(ServerConfig{Addr: addr})
+}
+
+// RunTLS starts the HTTPS server (enabling HTTP/2 by default) with production timeouts.
+func (e *Engine) RunTLS(addr, certFile, keyFile string) error {
+	return e.Server(ServerConfig{TLSAddr: addr, CertFile: certFile, KeyFile: keyFile})
+}
+
+// RunListener serves HTTP on an existing listener with Graceful Shutdown.
+func (e *Engine) RunListener(ln net.Listener) error {
+	return e.Server(ServerConfig{Listener: ln})
+}
+
+// RunUnix serves HTTP on a unix domain socket at path.
+// A stale socket left by a previous run is removed first; any other kind of
+// file at path is an error. The socket file is removed when serving stops.
+func (e *Engine) RunUnix(path string) error {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("kvolt: %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	// Unlink only our own socket: after a graceful restart the new process
+	// may already have bound a fresh one at the same path.
+	ln.SetUnlinkOnClose(false)
+	if own, err := os.Lstat(path); err == nil {
+		defer func() {
+			if fi, err := os.Lstat(path); err == nil && os.SameFile(own, fi) {
+				os.Remove(path)
+			}
+		}()
+	}
+	return e.RunListener(ln)
+}
@@ -0,0 +1,103 @@
+package kvolt
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/go-kvolt/kvolt/router"
+)
+
+// Name registers a name for the route, so its URL can be built with
+// Engine.URL, Context.URLFor or the "url" template function.
+// Names must be unique; registering one twice panics. A route that could
+// not be registered (see Engine.Validate) gets no name.
+func (r *Route) Name(name string) *Route {
+	e := r.engine
+	e.routesMu.Lock()
+	defer e.routesMu.Unlock()
+	if r.detached.Load() {
+		return r
+	}
+	if _, exists := e.namedRoutes[name]; exists {
+		panic("kvolt: route name '" + name + "' is already registered")
+	}
+	e.namedRoutes[name] = r
+	r.name = name
+	return r
+}
+
+// URL builds the path of the named route, filling its ":param" and
+// "*catchAll" segments with params in order. Values are formatted with
+// fmt.Sprint and escaped; catch-all values keep their "/" separators.
+func (e *Engine) URL(name string, params ...interface{}) (string, error) {
+	e.routesMu.RLock()
+	r, ok := e.namedRoutes[name]
+	e.routesMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("kvolt: no route named %q", name)
+	}
+	return buildURL(r.Path, params)
+}
+
+// buildURL substitutes params into the wildcards of a route pattern.
+// Constraints are dropped from the output but not checked; an optional
+// trailing param may be left out.
+func buildURL(pattern string, params []interface{}) (string, error) {
+	wildcards, err := router.Wildcards(pattern)
+	if err != nil {
+		return "", err
+	}
+	if n := len(wildcards); n > 0 && wildcards[n-1].Optional && len(params) == n-1 {
+		// Leave out the optional trailing segment
+		pattern = pattern[:wildcards[n-1].Start-1]
+		if pattern == "" {
+			pattern = "/"
+		}
+		wildcards = wildcards[:n-1]
+	}
+	if len(params) != len(wildcards) {
+		return "", fmt.Errorf("kvolt: %d values given for %d parameters in %q", len(params), len(wildcards), pattern)
+	}
+
+	var b strings.Builder
+	b.Grow(len(pattern))
+	pos := 0
+	for i, w := range wildcards {
+		b.WriteString(pattern[pos:w.Start])
+		pos = w.End
+
+		value := fmt.Sprint(params[i])
+		if !w.CatchAll {
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+		for j, seg := range segments {
+			if j > 0 {
+				b.WriteByte('/')
+			}
+			b.WriteString(url.PathEscape(seg))
+		}
+	}
+	b.WriteString(pattern[pos:])
+	return b.String(), nil
+}
+
+// FuncMap returns the template functions available to templates loaded by
+// the engine: {{ url "user.show" .ID }} renders the named route's path.
+func (e *Engine) FuncMap() template.FuncMap {
+	funcs := template.FuncMap{
+		"url": e.URL,
+	}
+	for k, v := range e.funcMap {
+		funcs[k] = v
+	}
+	return funcs
+}
+
+// SetFuncMap adds custom template functions. Call it before LoadHTMLGlob.
+func (e *Engine) SetFuncMap(funcs template.FuncMap) {
+	e.funcMap = funcs
+}
@@ -0,0 +1,171 @@
+package kvolt
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-kvolt/kvolt/context"
+	"github.com/go-kvolt/kvolt/router"
+)
+
+// RouteError reports a route that could not be registered.
+type RouteError struct {
+	Method string
+	Path   string
+	Host   string
+	// Source is the file:line where the route was registered.
+	Source string
+	// Existing is the registered route it conflicts with, nil when the
+	// pattern itself is invalid.
+	Existing *Route
+	// Shadowed is set when Existing matches exactly the same requests,
+	// so the new route could never be reached.
+	Shadowed bool
+	// Err is the router's error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *RouteError) Error() string {
+	var b strings.Builder
+	b.WriteString("kvolt: ")
+	writeRoute(&b, e.Method, e.Host, e.Path, e.Source)
+	if e.Existing != nil {
+		if e.Shadowed {
+			b.WriteString(" is shadowed by ")
+		} else {
+			b.WriteString(" conflicts with ")
+		}
+		writeRoute(&b, e.Existing.Method, e.Existing.Host, e.Existing.Path, e.Existing.Source)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+// Unwrap returns the router's error.
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+func writeRoute(b *strings.Builder, method, host, path, source string) {
+	b.WriteString(method)
+	b.WriteByte(' ')
+	b.WriteString(host)
+	b.WriteString(path)
+	if source != "" {
+		b.WriteString(" (")
+		b.WriteString(source)
+		b.WriteByte(')')
+	}
+}
+
+// Validate reports every route that could not be registered because its
+// pattern is invalid or it conflicts with, or is shadowed by, an earlier
+// route. The error joins one *RouteError per route, in registration order.
+// Server and the Run helpers call it before listening.
+func (e *Engine) Validate() error {
+	e.routesMu.RLock()
+	defer e.routesMu.RUnlock()
+	errs := make([]error, len(e.routeErrors))
+	for i, err := range e.routeErrors {
+		errs[i] = err
+	}
+	return errors.Join(errs...)
+}
+
+// Register adds a route like RouterGroup.Handle, but returns a *RouteError instead of
+// recording it for Validate when the route cannot be registered. Use it for
+// strict registration, e.g. from plugins that must fail loudly.
+func (group *RouterGroup) Register(method, path string, handlers ...context.HandlerFunc) (*Route, error) {
+	if method == "" {
+		panic("kvolt: HTTP method can not be empty")
+	}
+	route, err := group.insertRoute(method, path, handlers)
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// routeError describes why route could not be inserted.
+func routeError(route *Route, err error) *RouteError {
+	re := &RouteError{
+		Method: route.Method,
+		Path:   route.Path,
+		Host:   route.Host,
+		Source: route.Source,
+		Err:    err,
+	}
+	var conflict *router.ConflictError
+	if errors.As(err, &conflict) {
+		if existing, ok := conflict.Existing.(*Route); ok {
+			re.Existing = existing
+			re.Shadowed = shadows(existing.Path, conflict.Path)
+		}
+	}
+	return re
+}
+
+// shadows reports whether one of the patterns registered by existing
+// matches the same requests as pattern, i.e. differs only in param names.
+func shadows(existing, pattern string) bool {
+	patterns, err := router.Expand(existing)
+	if err != nil {
+		return false
+	}
+	want := anonymous(pattern)
+	for _, p := range patterns {
+		if anonymous(p) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymous drops the param names from a valid pattern, keeping constraints.
+func anonymous(pattern string) string {
+	wildcards, _ := router.Wildcards(pattern)
+	var b strings.Builder
+	pos := 0
+	for _, w := range wildcards {
+		b.WriteString(pattern[pos:w.Start])
+		switch {
+		case w.CatchAll:
+			b.WriteByte('*')
+		case w.Constraint != nil:
+			b.WriteString(":<" + w.Constraint.String() + ">")
+		default:
+			b.WriteByte(':')
+		}
+		pos = w.End
+	}
+	b.WriteString(pattern[pos:])
+	return b.String()
+}
+
+// packageDir is the directory of the kvolt sources, used to skip the
+// framework's own frames when recording where a route was registered.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// callerSource returns the file:line of the first caller outside package
+// kvolt (its tests count as callers).
+func callerSource() string {
+	var pcs [16]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}